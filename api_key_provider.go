@@ -0,0 +1,359 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+)
+
+const (
+	defaultApiKeyRefreshInterval = time.Minute
+	apiKeyProviderTimeout        = 10 * time.Second
+	// apiKeyFileCheckInterval is how often API key files are read to pick up changes, which is
+	// cheap enough to do far more often than calling other providers.
+	apiKeyFileCheckInterval = time.Second
+)
+
+// ApiKeyFromFile returns an API key provider that reads the key from the file at path, such as a
+// mounted Kubernetes secret. Surrounding whitespace is ignored.
+func ApiKeyFromFile(path string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("unable to read API key file: %w", err)
+		}
+		return string(data), nil
+	}
+}
+
+// ApiKeyFromCommand returns an API key provider that runs a command, such as a secrets manager
+// CLI, and uses what it writes to stdout as the key. Surrounding whitespace is ignored. The command
+// is run directly rather than by a shell, so name must be the program to run and args its
+// arguments, unquoted.
+func ApiKeyFromCommand(name string, args ...string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		output, err := exec.CommandContext(ctx, name, args...).Output()
+		if err != nil {
+			return "", fmt.Errorf("unable to run API key command %s: %w", name, err)
+		}
+		return string(output), nil
+	}
+}
+
+// WithApiKeyProvider() sets a function that returns the API key to send telemetry with, such as
+// one returned by ApiKeyFromFile(). The provider is called when OpenTelemetry is configured and
+// then periodically so that the key can change without restarting. If it fails when configuring,
+// that is reported like other misconfigurations and the key is picked up by a later refresh. A provider takes precedence over API keys set with WithApiKey() or HONEYCOMB_API_KEY.
+func WithApiKeyProvider(provider func(ctx context.Context) (string, error)) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		apiKeyProvidersFor(c).generic = &apiKeySource{provider: provider}
+	}
+}
+
+// WithTracesApiKeyProvider() sets a function that returns the API key to send traces telemetry with.
+// It behaves like WithApiKeyProvider() and takes precedence over it for traces.
+func WithTracesApiKeyProvider(provider func(ctx context.Context) (string, error)) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		apiKeyProvidersFor(c).traces = &apiKeySource{provider: provider}
+	}
+}
+
+// WithMetricsApiKeyProvider() sets a function that returns the API key to send metrics telemetry with.
+// It behaves like WithApiKeyProvider() and takes precedence over it for metrics.
+func WithMetricsApiKeyProvider(provider func(ctx context.Context) (string, error)) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		apiKeyProvidersFor(c).metrics = &apiKeySource{provider: provider}
+	}
+}
+
+// WithApiKeyFile() reads the API key to send telemetry with from the file at path, such as a
+// mounted Kubernetes secret. The file is checked every second once OpenTelemetry is configured,
+// and exporters switch to a new key as soon as it changes. It takes precedence over API keys set
+// with WithApiKey() or HONEYCOMB_API_KEY.
+func WithApiKeyFile(path string) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		apiKeyProvidersFor(c).generic = &apiKeySource{provider: ApiKeyFromFile(path), file: true}
+	}
+}
+
+// WithTracesApiKeyFile() reads the API key to send traces telemetry with from the file at path.
+// It behaves like WithApiKeyFile() and takes precedence over it for traces.
+func WithTracesApiKeyFile(path string) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		apiKeyProvidersFor(c).traces = &apiKeySource{provider: ApiKeyFromFile(path), file: true}
+	}
+}
+
+// WithMetricsApiKeyFile() reads the API key to send metrics telemetry with from the file at path.
+// It behaves like WithApiKeyFile() and takes precedence over it for metrics.
+func WithMetricsApiKeyFile(path string) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		apiKeyProvidersFor(c).metrics = &apiKeySource{provider: ApiKeyFromFile(path), file: true}
+	}
+}
+
+// WithApiKeyRefreshInterval() sets how often API key providers are called once OpenTelemetry is
+// configured, every minute by default. Keys are not refreshed if interval is not positive.
+func WithApiKeyRefreshInterval(interval time.Duration) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		apiKeyProvidersFor(c).refreshInterval = interval
+	}
+}
+
+// apiKeySource holds the most recent API key returned by a provider.
+type apiKeySource struct {
+	provider func(ctx context.Context) (string, error)
+	// file is set for keys read from files, which are checked for changes more often.
+	file bool
+	key  atomic.Pointer[string]
+}
+
+func (s *apiKeySource) current() string {
+	if key := s.key.Load(); key != nil {
+		return *key
+	}
+	return ""
+}
+
+// refresh calls the provider, reporting whether the key changed. The previous key is kept if the
+// provider fails.
+func (s *apiKeySource) refresh(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiKeyProviderTimeout)
+	defer cancel()
+	key, err := s.provider(ctx)
+	if err != nil {
+		return false, err
+	}
+	if key = strings.TrimSpace(key); key == "" {
+		return false, errors.New("API key provider returned an empty key")
+	}
+	previous := s.key.Swap(&key)
+	return previous == nil || *previous != key, nil
+}
+
+// apiKeyProviders are the API key providers configured for a config.
+type apiKeyProviders struct {
+	generic         *apiKeySource
+	traces          *apiKeySource
+	metrics         *apiKeySource
+	refreshInterval time.Duration
+	refreshSignals  []os.Signal
+	// refreshRequests asks a running watch to refresh the keys right away.
+	refreshRequests chan struct{}
+}
+
+func newApiKeyProviders() *apiKeyProviders {
+	return &apiKeyProviders{
+		refreshInterval: defaultApiKeyRefreshInterval,
+		refreshRequests: make(chan struct{}, 1),
+	}
+}
+
+func apiKeyProvidersFor(c *otelconfig.Config) *apiKeyProviders {
+	state := stateFor(c)
+	if state.apiKeys == nil {
+		state.apiKeys = newApiKeyProviders()
+	}
+	return state.apiKeys
+}
+
+func (p *apiKeyProviders) sources() []*apiKeySource {
+	var sources []*apiKeySource
+	for _, source := range []*apiKeySource{p.generic, p.traces, p.metrics} {
+		if source != nil {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// refresh calls each provider, reporting whether any key changed.
+func (p *apiKeyProviders) refresh(ctx context.Context) (bool, error) {
+	return p.refreshSources(ctx, p.sources())
+}
+
+// refreshFiles reads the keys from files again, reporting whether any key changed.
+func (p *apiKeyProviders) refreshFiles(ctx context.Context) (bool, error) {
+	return p.refreshSources(ctx, p.files())
+}
+
+func (p *apiKeyProviders) files() []*apiKeySource {
+	var files []*apiKeySource
+	for _, source := range p.sources() {
+		if source.file {
+			files = append(files, source)
+		}
+	}
+	return files
+}
+
+func (p *apiKeyProviders) refreshSources(ctx context.Context, sources []*apiKeySource) (bool, error) {
+	changed := false
+	var errs []error
+	for _, source := range sources {
+		sourceChanged, err := source.refresh(ctx)
+		changed = changed || sourceChanged
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// requestRefresh asks a running watch to refresh the keys right away.
+func (p *apiKeyProviders) requestRefresh() {
+	select {
+	case p.refreshRequests <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+}
+
+// watch refreshes the keys until stopped: every refresh interval, every second for key files,
+// when a refresh signal is received and when a refresh is requested. Failures are logged and
+// the previous keys kept.
+func (p *apiKeyProviders) watch(logger otelconfig.Logger) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	var refreshTicks, fileTicks <-chan time.Time
+	var tickers []*time.Ticker
+	if p.refreshInterval > 0 {
+		ticker := time.NewTicker(p.refreshInterval)
+		tickers = append(tickers, ticker)
+		refreshTicks = ticker.C
+	}
+	if len(p.files()) > 0 {
+		ticker := time.NewTicker(apiKeyFileCheckInterval)
+		tickers = append(tickers, ticker)
+		fileTicks = ticker.C
+	}
+	signals := make(chan os.Signal, 1)
+	if len(p.refreshSignals) > 0 {
+		signal.Notify(signals, p.refreshSignals...)
+	}
+
+	go func() {
+		defer close(done)
+		defer signal.Stop(signals)
+		defer func() {
+			for _, ticker := range tickers {
+				ticker.Stop()
+			}
+		}()
+		for {
+			var err error
+			select {
+			case <-ctx.Done():
+				return
+			case <-refreshTicks:
+				_, err = p.refresh(ctx)
+			case <-fileTicks:
+				_, err = p.refreshFiles(ctx)
+			case <-signals:
+				_, err = p.refresh(ctx)
+			case <-p.refreshRequests:
+				_, err = p.refresh(ctx)
+			}
+			if err != nil && logger != nil && ctx.Err() == nil {
+				logger.Debugf("%s\n%v", apiKeyRefreshErrorMessage, err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// tracesKey returns the current API key for traces, if it comes from a provider.
+func (p *apiKeyProviders) tracesKey() string {
+	if p.traces != nil {
+		return p.traces.current()
+	}
+	if p.generic != nil {
+		return p.generic.current()
+	}
+	return ""
+}
+
+// metricsKey returns the current API key for metrics, if it comes from a provider.
+func (p *apiKeyProviders) metricsKey() string {
+	if p.metrics != nil {
+		return p.metrics.current()
+	}
+	if p.generic != nil {
+		return p.generic.current()
+	}
+	return ""
+}
+
+// hasTracesKey reports whether the API key for traces comes from a provider.
+func (p *apiKeyProviders) hasTracesKey() bool {
+	return p != nil && (p.traces != nil || p.generic != nil)
+}
+
+// hasMetricsKey reports whether the API key for metrics comes from a provider.
+func (p *apiKeyProviders) hasMetricsKey() bool {
+	return p != nil && (p.metrics != nil || p.generic != nil)
+}
+
+// currentTracesHeaders returns the traces headers for c, using the current API key from keys,
+// which may be nil.
+func currentTracesHeaders(c *otelconfig.Config, keys *apiKeyProviders) map[string]string {
+	headers := tracesHeaders(c)
+	if keys != nil {
+		if key := keys.tracesKey(); key != "" {
+			headers[honeycombApiKeyHeader] = key
+		}
+	}
+	return headers
+}
+
+// loadApiKeys calls the API key providers in keys and sets the headers in c to the keys they
+// return, so that the keys are validated like any other. If a provider fails it is reported as a
+// configuration problem, and its key is picked up once a later refresh succeeds.
+func loadApiKeys(c *otelconfig.Config, keys *apiKeyProviders) []configProblem {
+	var problems []configProblem
+	if _, err := keys.refresh(context.Background()); err != nil {
+		problems = append(problems, configProblem{format: apiKeyLoadErrorMessage, args: []interface{}{err}})
+	}
+	for _, source := range []struct {
+		source  *apiKeySource
+		headers map[string]string
+	}{
+		{keys.generic, c.Headers},
+		{keys.traces, c.TracesHeaders},
+		{keys.metrics, c.MetricsHeaders},
+	} {
+		if source.source == nil {
+			continue
+		}
+		if key := source.source.current(); key != "" {
+			source.headers[honeycombApiKeyHeader] = key
+		}
+	}
+	return problems
+}
@@ -0,0 +1,196 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/honeycomb-opentelemetry-go/honeycombtest"
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestApiKeyFromFileTrimsWhitespace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikey")
+	require.NoError(t, os.WriteFile(path, []byte("  file-key\n"), 0o600))
+	source := &apiKeySource{provider: ApiKeyFromFile(path)}
+
+	changed, err := source.refresh(context.Background())
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "file-key", source.current())
+
+	changed, err = source.refresh(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestApiKeyFromCommandUsesOutput(t *testing.T) {
+	source := &apiKeySource{provider: ApiKeyFromCommand("echo", "command-key")}
+
+	_, err := source.refresh(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "command-key", source.current())
+}
+
+func TestApiKeySourceKeepsPreviousKeyOnError(t *testing.T) {
+	var fail atomic.Bool
+	source := &apiKeySource{provider: func(ctx context.Context) (string, error) {
+		if fail.Load() {
+			return "", errors.New("unavailable")
+		}
+		return "first-key", nil
+	}}
+	_, err := source.refresh(context.Background())
+	require.NoError(t, err)
+
+	fail.Store(true)
+	_, err = source.refresh(context.Background())
+	assert.ErrorContains(t, err, "unavailable")
+	assert.Equal(t, "first-key", source.current())
+}
+
+func TestApiKeyFileEnvironmentVariables(t *testing.T) {
+	dir := t.TempDir()
+	for name, key := range map[string]string{"apikey": "generic-key", "traces": "traces-key", "metrics": "metrics-key"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(key), 0o600))
+	}
+	t.Setenv("HONEYCOMB_API_KEY", "static-key")
+	t.Setenv("HONEYCOMB_API_KEY_FILE", filepath.Join(dir, "apikey"))
+	t.Setenv("HONEYCOMB_TRACES_APIKEY_FILE", filepath.Join(dir, "traces"))
+	t.Setenv("HONEYCOMB_METRICS_APIKEY_FILE", filepath.Join(dir, "metrics"))
+	t.Setenv("HONEYCOMB_API_KEY_REFRESH_INTERVAL", "5s")
+	config := freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+
+	keys := takeConfigState(config).apiKeys
+	require.NotNil(t, keys)
+	assert.Empty(t, loadApiKeys(config, keys))
+	assert.Equal(t, 5*time.Second, keys.refreshInterval)
+	assert.Equal(t, "generic-key", config.Headers[honeycombApiKeyHeader])
+	assert.Equal(t, "traces-key", currentTracesHeaders(config, keys)[honeycombApiKeyHeader])
+	assert.Equal(t, "metrics-key", metricsHeaders(config)[honeycombApiKeyHeader])
+}
+
+func TestApiKeyCommandEnvironmentVariable(t *testing.T) {
+	t.Setenv("HONEYCOMB_API_KEY_COMMAND", "echo command-key")
+	config := freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	keys := takeConfigState(config).apiKeys
+	require.NotNil(t, keys)
+	assert.Empty(t, loadApiKeys(config, keys))
+	assert.Equal(t, "command-key", config.Headers[honeycombApiKeyHeader])
+
+	// commands that a shell would have to unquote aren't run
+	t.Setenv("HONEYCOMB_API_KEY_COMMAND", `"/opt/my secrets/get-key" --name 'honeycomb key'`)
+	config = freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	state := takeConfigState(config)
+	assert.Nil(t, state.apiKeys)
+	require.Len(t, state.problems, 1)
+	assert.Equal(t, "HONEYCOMB_API_KEY_COMMAND", state.problems[0].args[0])
+}
+
+func TestApiKeyProviderErrorIsReported(t *testing.T) {
+	useValidateConfig(t)
+	t.Setenv("HONEYCOMB_API_KEY", "")
+	path := filepath.Join(t.TempDir(), "apikey")
+
+	// with strict validation, configuration fails
+	shutdown, err := otelconfig.ConfigureOpenTelemetry(
+		WithStrictValidation(),
+		WithApiKeyFile(path),
+	)
+	assert.Nil(t, shutdown)
+	assert.ErrorContains(t, err, "unable to read API key file")
+
+	// otherwise the key is used once it can be loaded
+	server := honeycombtest.NewServer(t)
+	options := append(server.GRPCOptions(),
+		otelconfig.WithMetricsEnabled(false),
+		WithApiKeyFile(path),
+	)
+	shutdown, err = otelconfig.ConfigureOpenTelemetry(options...)
+	require.NoError(t, err)
+	defer shutdown()
+
+	require.NoError(t, os.WriteFile(path, []byte("file-key"), 0o600))
+	require.Eventually(t, func() bool {
+		exportSpan(t)
+		return lastApiKey(server) == "file-key"
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestApiKeyProviderRotatesKeyWithoutRestarting(t *testing.T) {
+	useValidateConfig(t)
+	t.Setenv("HONEYCOMB_API_KEY", "")
+	server := honeycombtest.NewServer(t)
+	var key atomic.Value
+	key.Store("first-key")
+
+	options := append(server.GRPCOptions(),
+		otelconfig.WithMetricsEnabled(false),
+		WithApiKeyProvider(func(ctx context.Context) (string, error) {
+			return key.Load().(string), nil
+		}),
+		WithApiKeyRefreshInterval(10*time.Millisecond),
+	)
+	shutdown, err := otelconfig.ConfigureOpenTelemetry(options...)
+	require.NoError(t, err)
+	defer shutdown()
+
+	exportSpan(t)
+	assert.Equal(t, "first-key", lastApiKey(server))
+
+	key.Store("second-key")
+	require.Eventually(t, func() bool {
+		exportSpan(t)
+		return lastApiKey(server) == "second-key"
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+// exportSpan ends a span and flushes it to the exporter.
+func exportSpan(t *testing.T) {
+	t.Helper()
+	tp, ok := otel.GetTracerProvider().(*trace.TracerProvider)
+	require.True(t, ok)
+	_, span := otel.Tracer("test").Start(context.Background(), "span")
+	span.End()
+	require.NoError(t, tp.ForceFlush(context.Background()))
+}
+
+// lastApiKey returns the API key of the most recent export received by server.
+func lastApiKey(server *honeycombtest.Server) string {
+	requests := server.Requests()
+	if len(requests) == 0 {
+		return ""
+	}
+	return requests[len(requests)-1].Headers[honeycombApiKeyHeader]
+}
@@ -0,0 +1,109 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+)
+
+// RotatableApiKey is an API key that can be replaced while the application is running, such as
+// when a deployment system pushes a new key. Exporters configured with WithRotatableApiKey()
+// switch to the new key without being restarted.
+type RotatableApiKey struct {
+	mu        sync.Mutex
+	key       string
+	providers []*apiKeyProviders
+}
+
+// NewRotatableApiKey returns a RotatableApiKey starting with key.
+func NewRotatableApiKey(key string) *RotatableApiKey {
+	return &RotatableApiKey{key: key}
+}
+
+// Get returns the current key.
+func (k *RotatableApiKey) Get() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.key
+}
+
+// Rotate replaces the key. The exporters pick it up in the background right away and send it with
+// every export from then on, without creating new connections.
+func (k *RotatableApiKey) Rotate(key string) {
+	k.mu.Lock()
+	k.key = key
+	providers := append([]*apiKeyProviders{}, k.providers...)
+	k.mu.Unlock()
+	for _, p := range providers {
+		p.requestRefresh()
+	}
+}
+
+func (k *RotatableApiKey) provide(context.Context) (string, error) {
+	if key := k.Get(); key != "" {
+		return key, nil
+	}
+	return "", errors.New("rotatable API key is empty")
+}
+
+// WithRotatableApiKey() sends telemetry with key, switching to new keys as they are rotated. It
+// takes precedence over API keys set with WithApiKey() or HONEYCOMB_API_KEY.
+func WithRotatableApiKey(key *RotatableApiKey) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		p := apiKeyProvidersFor(c)
+		p.generic = &apiKeySource{provider: key.provide}
+		withSetup(func(*otelconfig.Config) (func(), error) {
+			key.register(p)
+			return func() { key.unregister(p) }, nil
+		})(c)
+	}
+}
+
+// register makes rotations refresh the keys from p, until unregistered when OpenTelemetry is
+// shut down.
+func (k *RotatableApiKey) register(p *apiKeyProviders) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.providers = append(k.providers, p)
+}
+
+func (k *RotatableApiKey) unregister(p *apiKeyProviders) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i, provider := range k.providers {
+		if provider == p {
+			k.providers = append(k.providers[:i], k.providers[i+1:]...)
+			return
+		}
+	}
+}
+
+// WithApiKeyRefreshOnSignal() refreshes API keys from files, commands and other providers when the
+// process receives one of signals, SIGHUP by default, so that a new key can be picked up right
+// away without restarting.
+func WithApiKeyRefreshOnSignal(signals ...os.Signal) otelconfig.Option {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	return func(c *otelconfig.Config) {
+		apiKeyProvidersFor(c).refreshSignals = signals
+	}
+}
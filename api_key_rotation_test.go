@@ -0,0 +1,116 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/honeycomb-opentelemetry-go/honeycombtest"
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatableApiKeyIsSentAfterRotationDuringGracePeriod(t *testing.T) {
+	for _, protocol := range []string{"grpc", "http"} {
+		t.Run(protocol, func(t *testing.T) {
+			useValidateConfig(t)
+			t.Setenv("HONEYCOMB_API_KEY", "")
+			server := honeycombtest.NewServer(t, honeycombtest.WithApiKey("old-key"))
+			key := NewRotatableApiKey("old-key")
+
+			options := server.GRPCOptions()
+			if protocol == "http" {
+				options = server.HTTPOptions()
+			}
+			options = append(options,
+				otelconfig.WithMetricsEnabled(false),
+				WithRotatableApiKey(key),
+				WithApiKeyRefreshInterval(0),
+			)
+			shutdown, err := otelconfig.ConfigureOpenTelemetry(options...)
+			require.NoError(t, err)
+			defer shutdown()
+
+			exportSpan(t)
+			assert.Equal(t, "old-key", lastApiKey(server))
+
+			server.RotateApiKey("new-key", time.Minute)
+			key.Rotate("new-key")
+			require.Eventually(t, func() bool {
+				exportSpan(t)
+				return lastApiKey(server) == "new-key"
+			}, 5*time.Second, 20*time.Millisecond)
+			for _, request := range server.Requests() {
+				assert.NoError(t, request.Err)
+			}
+		})
+	}
+}
+
+func TestRotatableApiKeyIsOnlyUsedWhileConfigured(t *testing.T) {
+	key := NewRotatableApiKey("hcaik_01j0000000000000000000000000000000000000000000000000000000")
+
+	// nothing is registered if validation fails
+	config := freshConfig()
+	WithRotatableApiKey(key)(config)
+	WithStrictValidation()(config)
+	WithApiKeyRefreshInterval(0)(config)
+	config.ExporterEndpoint = "not a valid endpoint"
+	require.Error(t, validateConfig(config))
+	assert.Empty(t, key.providers)
+
+	// or once shut down
+	config = freshConfig()
+	WithRotatableApiKey(key)(config)
+	WithApiKeyRefreshInterval(0)(config)
+	config.TracesEnabled = false
+	config.MetricsEnabled = false
+	require.NoError(t, validateConfig(config))
+	assert.Len(t, key.providers, 1)
+	for _, shutdown := range config.ShutdownFunctions {
+		require.NoError(t, shutdown(config))
+	}
+	assert.Empty(t, key.providers)
+}
+
+func TestApiKeyFileChangesAreUsedWithoutRestarting(t *testing.T) {
+	useValidateConfig(t)
+	t.Setenv("HONEYCOMB_API_KEY", "")
+	server := honeycombtest.NewServer(t)
+	path := filepath.Join(t.TempDir(), "apikey")
+	require.NoError(t, os.WriteFile(path, []byte("old-key\n"), 0o600))
+
+	options := append(server.GRPCOptions(),
+		otelconfig.WithMetricsEnabled(false),
+		WithApiKeyFile(path),
+		WithApiKeyRefreshInterval(0),
+	)
+	shutdown, err := otelconfig.ConfigureOpenTelemetry(options...)
+	require.NoError(t, err)
+	defer shutdown()
+
+	exportSpan(t)
+	assert.Equal(t, "old-key", lastApiKey(server))
+
+	require.NoError(t, os.WriteFile(path, []byte("new-key\n"), 0o600))
+	require.Eventually(t, func() bool {
+		exportSpan(t)
+		return lastApiKey(server) == "new-key"
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,49 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package honeycomb
+
+import (
+	"context"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiKeysAreRefreshedOnSignal(t *testing.T) {
+	config := freshConfig()
+	var key atomic.Value
+	key.Store("old-key")
+	WithApiKeyProvider(func(ctx context.Context) (string, error) {
+		return key.Load().(string), nil
+	})(config)
+	WithApiKeyRefreshInterval(0)(config)
+	WithApiKeyRefreshOnSignal()(config)
+
+	keys := takeConfigState(config).apiKeys
+	require.Empty(t, loadApiKeys(config, keys))
+	stop := keys.watch(nil)
+	defer stop()
+
+	key.Store("new-key")
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool {
+		return keys.tracesKey() == "new-key"
+	}, 5*time.Second, 10*time.Millisecond)
+}
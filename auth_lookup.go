@@ -0,0 +1,314 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultApiEndpoint = "https://api.honeycomb.io"
+
+	authRequestTimeout  = 5 * time.Second
+	authAttempts        = 3
+	authBackoff         = 250 * time.Millisecond
+	authRetryInterval   = time.Minute
+	authCacheTTL        = 24 * time.Hour
+	authCacheFileSuffix = ".json"
+	authCacheSecretFile = "secret"
+	authCacheSecretSize = 32
+)
+
+// errAuthRejected is returned when Honeycomb rejects an API key, which retrying will not fix.
+var errAuthRejected = errors.New("API key was rejected")
+
+// authLookup looks up the team and environment an API key belongs to using Honeycomb's
+// /1/auth endpoint.
+//
+// Lookups are made when first needed, rather than at startup, with a timeout per request and a
+// few retries. Successful lookups are cached in memory and on disk, so later runs don't need to
+// make a request. Failed lookups are not retried until retryInterval has passed, so being offline
+// only delays the first callers. Each lookup runs in the background, so callers can stop waiting
+// for it when their context is done without affecting it or other callers.
+type authLookup struct {
+	client        *http.Client
+	cacheDir      string
+	attempts      int
+	backoff       time.Duration
+	retryInterval time.Duration
+	now           func() time.Time
+
+	mu       sync.Mutex
+	endpoint string
+	apikey   string
+	result   *honeycombAuthResponse
+	retryAt  time.Time
+	pending  *authFetch
+}
+
+// authFetch is a lookup in progress. result is set, if the lookup succeeded, before done is closed.
+type authFetch struct {
+	done   chan struct{}
+	result *honeycombAuthResponse
+}
+
+func newAuthLookup() *authLookup {
+	cacheDir, err := os.UserCacheDir()
+	if err == nil {
+		cacheDir = filepath.Join(cacheDir, "honeycomb-opentelemetry-go")
+	}
+	return &authLookup{
+		client:        &http.Client{Timeout: authRequestTimeout},
+		cacheDir:      cacheDir,
+		attempts:      authAttempts,
+		backoff:       authBackoff,
+		retryInterval: authRetryInterval,
+		now:           time.Now,
+	}
+}
+
+// lookup returns the team and environment for apikey from the Honeycomb API at endpoint, which
+// defaults to Honeycomb's US API when empty, or false if they could not be found.
+func (a *authLookup) lookup(ctx context.Context, endpoint string, apikey string) (*honeycombAuthResponse, bool) {
+	result, pending := a.start(endpoint, apikey)
+	if pending == nil {
+		return result, result != nil
+	}
+	select {
+	case <-pending.done:
+		return pending.result, pending.result != nil
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// cached returns the team and environment for apikey at endpoint if they have already been looked
+// up, or false without waiting if they haven't, starting to look them up in the background.
+func (a *authLookup) cached(endpoint string, apikey string) (*honeycombAuthResponse, bool) {
+	result, _ := a.start(endpoint, apikey)
+	return result, result != nil
+}
+
+// start returns the result for apikey at endpoint if it is known, or else the lookup in progress
+// for it, starting one unless a failed lookup is waiting to be retried.
+func (a *authLookup) start(endpoint string, apikey string) (*honeycombAuthResponse, *authFetch) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if endpoint != a.endpoint || apikey != a.apikey {
+		a.endpoint = endpoint
+		a.apikey = apikey
+		a.result = nil
+		a.retryAt = time.Time{}
+		a.pending = nil
+	}
+	if a.result != nil || apikey == "" || a.now().Before(a.retryAt) {
+		return a.result, nil
+	}
+	if a.pending == nil {
+		a.pending = &authFetch{done: make(chan struct{})}
+		go a.run(a.pending, endpoint, apikey)
+	}
+	return nil, a.pending
+}
+
+// run looks up apikey from the disk cache or Honeycomb for f. It isn't tied to any caller's
+// context, so only failures to reach Honeycomb delay the next lookup, not callers giving up.
+func (a *authLookup) run(f *authFetch, endpoint string, apikey string) {
+	defer close(f.done)
+	result, ok := a.readCache(endpoint, apikey)
+	if !ok {
+		var err error
+		if result, err = a.fetch(context.Background(), endpoint, apikey); err == nil {
+			a.writeCache(endpoint, apikey, result)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f.result = result
+	if a.pending != f {
+		// the endpoint or API key changed while looking up
+		return
+	}
+	a.pending = nil
+	if result == nil {
+		a.retryAt = a.now().Add(a.retryInterval)
+		return
+	}
+	a.result = result
+}
+
+// fetch requests the auth information for apikey, retrying transient failures.
+func (a *authLookup) fetch(ctx context.Context, endpoint string, apikey string) (*honeycombAuthResponse, error) {
+	var err error
+	for attempt := 0; attempt < a.attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(a.backoff << (attempt - 1)):
+			}
+		}
+		var result *honeycombAuthResponse
+		result, err = a.fetchOnce(ctx, endpoint, apikey)
+		if err == nil {
+			return result, nil
+		}
+		if errors.Is(err, errAuthRejected) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (a *authLookup) fetchOnce(ctx context.Context, endpoint string, apikey string) (*honeycombAuthResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, authUrl(endpoint), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Honeycomb-Team", apikey)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, errAuthRejected
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status from Honeycomb auth: %s", resp.Status)
+	}
+
+	var hnyAuthResp honeycombAuthResponse
+	if err := json.Unmarshal(body, &hnyAuthResp); err != nil {
+		return nil, err
+	}
+	return &hnyAuthResp, nil
+}
+
+// cachePath returns the cache file for apikey at endpoint, or "" if there is none. The file is
+// named using a hash keyed with a secret kept in the cache directory, so the API key itself is
+// never written to disk and can't be confirmed from the name. The secret is created if create is
+// true and there isn't one yet.
+func (a *authLookup) cachePath(endpoint string, apikey string, create bool) string {
+	if a.cacheDir == "" {
+		return ""
+	}
+	secret, err := a.cacheSecret(create)
+	if err != nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(authUrl(endpoint) + "\n" + apikey))
+	return filepath.Join(a.cacheDir, "auth-"+hex.EncodeToString(mac.Sum(nil))+authCacheFileSuffix)
+}
+
+// cacheSecret returns the secret cache files are named with, creating it and the cache directory,
+// readable only by the current user, if create is true and they don't exist.
+func (a *authLookup) cacheSecret(create bool) ([]byte, error) {
+	path := filepath.Join(a.cacheDir, authCacheSecretFile)
+	secret, err := os.ReadFile(path)
+	if err == nil || !create || !errors.Is(err, os.ErrNotExist) {
+		return secret, err
+	}
+	if err := os.MkdirAll(a.cacheDir, 0o700); err != nil {
+		return nil, err
+	}
+	secret = make([]byte, authCacheSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		// created by another process in the meantime
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(secret); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return secret, f.Close()
+}
+
+func (a *authLookup) readCache(endpoint string, apikey string) (*honeycombAuthResponse, bool) {
+	path := a.cachePath(endpoint, apikey, false)
+	if path == "" {
+		return nil, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || a.now().Sub(info.ModTime()) > authCacheTTL {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var result honeycombAuthResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, false
+	}
+	return &result, true
+}
+
+// writeCache saves result for later runs. Failing to do so only costs a request next time,
+// so errors are ignored.
+func (a *authLookup) writeCache(endpoint string, apikey string, result *honeycombAuthResponse) {
+	path := a.cachePath(endpoint, apikey, true)
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0o600)
+}
+
+// authUrl returns the URL of the /1/auth endpoint for a Honeycomb API endpoint, which may be given
+// with or without a scheme, as with HONEYCOMB_API_ENDPOINT.
+func authUrl(endpoint string) string {
+	if endpoint == "" {
+		endpoint = defaultApiEndpoint
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/1/auth"
+}
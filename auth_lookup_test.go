@@ -0,0 +1,174 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAuthServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+// newTestAuthServer returns a fake Honeycomb /1/auth endpoint responding with each of statuses
+// in turn, repeating the last one.
+func newTestAuthServer(t *testing.T, statuses ...int) *testAuthServer {
+	server := &testAuthServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(server.requests.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		if r.URL.Path != "/1/auth" || r.Header.Get("X-Honeycomb-Team") == "" {
+			status = http.StatusUnauthorized
+		}
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"team":{"slug":"my-team"},"environment":{"slug":"my-env"}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestAuthLookup(t *testing.T) *authLookup {
+	lookup := newAuthLookup()
+	lookup.cacheDir = t.TempDir()
+	lookup.backoff = time.Millisecond
+	return lookup
+}
+
+func TestAuthLookupCachesResult(t *testing.T) {
+	server := newTestAuthServer(t, http.StatusOK)
+	lookup := newTestAuthLookup(t)
+
+	result, ok := lookup.lookup(context.Background(), server.URL, "key")
+	require.True(t, ok)
+	assert.Equal(t, "my-team", result.Team.Slug)
+	assert.Equal(t, "my-env", result.Environment.Slug)
+	_, ok = lookup.lookup(context.Background(), server.URL, "key")
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), server.requests.Load())
+
+	// a later run reads the result from disk
+	cached := newAuthLookup()
+	cached.cacheDir = lookup.cacheDir
+	result, ok = cached.lookup(context.Background(), server.URL, "key")
+	require.True(t, ok)
+	assert.Equal(t, "my-team", result.Team.Slug)
+	assert.Equal(t, int32(1), server.requests.Load())
+
+	// but not for a different API key
+	_, ok = cached.lookup(context.Background(), server.URL, "other-key")
+	assert.True(t, ok)
+	assert.Equal(t, int32(2), server.requests.Load())
+}
+
+func TestAuthLookupRetriesTransientFailures(t *testing.T) {
+	server := newTestAuthServer(t, http.StatusServiceUnavailable, http.StatusOK)
+	lookup := newTestAuthLookup(t)
+
+	_, ok := lookup.lookup(context.Background(), server.URL, "key")
+	assert.True(t, ok)
+	assert.Equal(t, int32(2), server.requests.Load())
+}
+
+func TestAuthLookupDoesNotRetryRejectedKeys(t *testing.T) {
+	server := newTestAuthServer(t, http.StatusUnauthorized)
+	lookup := newTestAuthLookup(t)
+
+	_, ok := lookup.lookup(context.Background(), server.URL, "key")
+	assert.False(t, ok)
+	assert.Equal(t, int32(1), server.requests.Load())
+}
+
+func TestAuthLookupWaitsBeforeTryingAgain(t *testing.T) {
+	server := newTestAuthServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK)
+	lookup := newTestAuthLookup(t)
+	now := time.Now()
+	lookup.now = func() time.Time { return now }
+
+	_, ok := lookup.lookup(context.Background(), server.URL, "key")
+	assert.False(t, ok)
+	assert.Equal(t, int32(authAttempts), server.requests.Load())
+
+	_, ok = lookup.lookup(context.Background(), server.URL, "key")
+	assert.False(t, ok)
+	assert.Equal(t, int32(authAttempts), server.requests.Load())
+
+	now = now.Add(authRetryInterval)
+	_, ok = lookup.lookup(context.Background(), server.URL, "key")
+	assert.True(t, ok)
+}
+
+func TestAuthLookupWithoutApiKey(t *testing.T) {
+	server := newTestAuthServer(t, http.StatusOK)
+	lookup := newTestAuthLookup(t)
+
+	_, ok := lookup.lookup(context.Background(), server.URL, "")
+	assert.False(t, ok)
+	assert.Equal(t, int32(0), server.requests.Load())
+}
+
+func TestAuthUrl(t *testing.T) {
+	assert.Equal(t, "https://api.honeycomb.io/1/auth", authUrl(""))
+	assert.Equal(t, "https://api.eu1.honeycomb.io/1/auth", authUrl("https://api.eu1.honeycomb.io/"))
+	assert.Equal(t, "https://api.eu1.honeycomb.io:443/1/auth", authUrl("api.eu1.honeycomb.io:443"))
+	assert.Equal(t, "http://localhost:8080/1/auth", authUrl("http://localhost:8080"))
+}
+
+func TestAuthLookupCallersCanStopWaiting(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte(`{"team":{"slug":"my-team"},"environment":{"slug":"my-env"}}`))
+	}))
+	t.Cleanup(server.Close)
+	lookup := newTestAuthLookup(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, ok := lookup.lookup(ctx, server.URL, "key")
+	assert.False(t, ok)
+
+	// giving up doesn't stop the lookup, or delay the next one
+	close(release)
+	result, ok := lookup.lookup(context.Background(), server.URL, "key")
+	require.True(t, ok)
+	assert.Equal(t, "my-team", result.Team.Slug)
+}
+
+func TestAuthLookupCacheFileNameIsKeyed(t *testing.T) {
+	server := newTestAuthServer(t, http.StatusOK)
+	lookup := newAuthLookup()
+	lookup.cacheDir = filepath.Join(t.TempDir(), "cache")
+
+	_, ok := lookup.lookup(context.Background(), server.URL, "key")
+	require.True(t, ok)
+	path := lookup.cachePath(server.URL, "key", false)
+	require.NotEmpty(t, path)
+	unsalted := sha256.Sum256([]byte(authUrl(server.URL) + "\n" + "key"))
+	assert.NotContains(t, path, hex.EncodeToString(unsalted[:16]))
+}
@@ -0,0 +1,46 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package honeycomb
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthLookupCacheIsOnlyReadableByOwner(t *testing.T) {
+	server := newTestAuthServer(t, http.StatusOK)
+	lookup := newAuthLookup()
+	lookup.cacheDir = filepath.Join(t.TempDir(), "cache")
+
+	_, ok := lookup.lookup(context.Background(), server.URL, "key")
+	require.True(t, ok)
+	for name, mode := range map[string]os.FileMode{
+		lookup.cacheDir: 0o700,
+		filepath.Join(lookup.cacheDir, authCacheSecretFile): 0o600,
+		lookup.cachePath(server.URL, "key", false):          0o600,
+	} {
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.Equal(t, mode, info.Mode().Perm(), name)
+	}
+}
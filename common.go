@@ -4,6 +4,21 @@ const (
 	noApiKeyDetectedMessage         string = "Missing an API Key!\nConfigure via HONEYCOMB_API_KEY environment variable, or in code."
 	classicKeyMissingDatasetMessage string = "Honeycomb Classic API Key detected!\nYour API key: %s requires a dataset to be configured.\nConfigure via HONEYCOMB_DATASET or in code."
 	dontSetADatasetMessageMessage   string = "Dataset detected! Datasets are a Honeycomb Classic configuration value.\nUnset HONEYCOMB_DATASET or remove configuration code that sets a dataset."
+	samplerRulesFileErrorMessage    string = "Unable to load sampling rules!\nCheck the file configured via HONEYCOMB_SAMPLER_RULES_FILE. Keeping the existing sampler."
+	samplerRulesFileInvalidMessage  string = "Invalid sampling rules detected!\nThe file %s configured via HONEYCOMB_SAMPLER_RULES_FILE can't be used, so spans are sampled at SAMPLE_RATE until it's fixed: %v"
+	conflictingApiKeysMessage       string = "Conflicting API keys detected!\nThe API key set via HONEYCOMB_API_KEY is overridden by a different key for every enabled signal.\nUnset HONEYCOMB_API_KEY or the per-signal API keys."
+	invalidEndpointMessage          string = "Invalid endpoint detected!\nThe %s %q is not a valid URL or host."
+	conflictingSampleRatesMessage   string = "Conflicting sampler settings detected!\nSAMPLE_RATE %q is ignored because HONEYCOMB_SAMPLER_TARGET_EPS is also set.\nUnset one of them."
+	conflictingSpanExportMessage    string = "Conflicting span export options detected!\n%s replaces %s, since only one of them can export spans.\nUse one or the other."
+	invalidSettingMessage           string = "Invalid setting detected!\n%s is %q, but should be %s. Ignoring it."
+	configFileInvalidMessage        string = "Invalid config file detected!\nThe file configured via %s can't be used, so it is ignored until it's fixed: %v"
+	localUIErrorMessage             string = "Unable to start the local trace UI!\nCheck the address configured via HONEYCOMB_LOCAL_UI_ADDR is free."
+	invalidApiKeyMessage            string = "Invalid API key detected!\nHoneycomb rejected the API key for %s. Check it is correct and hasn't been revoked."
+	apiKeyCannotSendMessage         string = "API key can't send telemetry!\nThe API key for %s doesn't have permission to send events."
+	keyValidatedMessage             string = "API key validated!\nThe API key for %s belongs to team %q and environment %q, and can send events: %t."
+	keyValidationErrorMessage       string = "Unable to validate the API key!\nThe API key for %s couldn't be checked with Honeycomb: %v"
+	apiKeyLoadErrorMessage          string = "Unable to load the API key!\nCheck the API key file, command or provider. It will be tried again while running: %v"
+	apiKeyRefreshErrorMessage       string = "Unable to refresh the API key!\nCheck the API key file, command or provider. Keeping the existing API key."
 )
 
 func isClassicApiKey(apiKey string) bool {
@@ -0,0 +1,258 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the format of the configuration file set with HONEYCOMB_CONFIG_FILE. Each setting
+// corresponds to an environment variable, which overrides it when set.
+type ConfigFile struct {
+	// ServiceName corresponds to OTEL_SERVICE_NAME.
+	ServiceName string `json:"service_name,omitempty" yaml:"service_name,omitempty"`
+	// Endpoint corresponds to HONEYCOMB_API_ENDPOINT.
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// Protocol corresponds to OTEL_EXPORTER_OTLP_PROTOCOL: grpc or http/protobuf.
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	// Insecure corresponds to OTEL_EXPORTER_OTLP_INSECURE.
+	Insecure *bool `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	// ApiKey corresponds to HONEYCOMB_API_KEY.
+	ApiKey string `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	// Dataset corresponds to HONEYCOMB_DATASET.
+	Dataset string `json:"dataset,omitempty" yaml:"dataset,omitempty"`
+	// Debug corresponds to DEBUG.
+	Debug *bool `json:"debug,omitempty" yaml:"debug,omitempty"`
+	// Strict corresponds to HONEYCOMB_STRICT_CONFIG.
+	Strict     *bool                `json:"strict,omitempty" yaml:"strict,omitempty"`
+	Traces     SignalConfigFile     `json:"traces,omitempty" yaml:"traces,omitempty"`
+	Metrics    MetricsConfigFile    `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+	Sampling   SamplingConfigFile   `json:"sampling,omitempty" yaml:"sampling,omitempty"`
+	Processors ProcessorsConfigFile `json:"processors,omitempty" yaml:"processors,omitempty"`
+}
+
+// SignalConfigFile overrides the endpoint, API key and dataset for traces, corresponding to
+// HONEYCOMB_TRACES_API_ENDPOINT, HONEYCOMB_TRACES_APIKEY and HONEYCOMB_TRACES_DATASET.
+type SignalConfigFile struct {
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	ApiKey   string `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	Dataset  string `json:"dataset,omitempty" yaml:"dataset,omitempty"`
+}
+
+// MetricsConfigFile overrides the endpoint, API key and dataset for metrics, corresponding to
+// HONEYCOMB_METRICS_API_ENDPOINT, HONEYCOMB_METRICS_APIKEY and HONEYCOMB_METRICS_DATASET.
+type MetricsConfigFile struct {
+	// Enabled corresponds to OTEL_METRICS_ENABLED.
+	Enabled  *bool  `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	ApiKey   string `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	Dataset  string `json:"dataset,omitempty" yaml:"dataset,omitempty"`
+}
+
+// SamplingConfigFile configures the sampler.
+type SamplingConfigFile struct {
+	// SampleRate corresponds to SAMPLE_RATE.
+	SampleRate *int `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty"`
+	// TargetEPS corresponds to HONEYCOMB_SAMPLER_TARGET_EPS.
+	TargetEPS *float64 `json:"target_eps,omitempty" yaml:"target_eps,omitempty"`
+	// RulesFile corresponds to HONEYCOMB_SAMPLER_RULES_FILE.
+	RulesFile string `json:"rules_file,omitempty" yaml:"rules_file,omitempty"`
+	// ReloadInterval corresponds to HONEYCOMB_SAMPLER_RELOAD_INTERVAL, e.g. "30s".
+	ReloadInterval string `json:"reload_interval,omitempty" yaml:"reload_interval,omitempty"`
+	// ParentBased corresponds to HONEYCOMB_SAMPLER_PARENT_BASED.
+	ParentBased *bool `json:"parent_based,omitempty" yaml:"parent_based,omitempty"`
+	// ErrorBiased corresponds to HONEYCOMB_SAMPLER_ERROR_BIASED.
+	ErrorBiased *bool `json:"error_biased,omitempty" yaml:"error_biased,omitempty"`
+}
+
+// ProcessorsConfigFile enables the span processors used for local development.
+type ProcessorsConfigFile struct {
+	// LocalVisualizations corresponds to HONEYCOMB_ENABLE_LOCAL_VISUALIZATIONS.
+	LocalVisualizations *bool `json:"local_visualizations,omitempty" yaml:"local_visualizations,omitempty"`
+	// LocalTraceSummary corresponds to HONEYCOMB_ENABLE_LOCAL_TRACE_SUMMARY.
+	LocalTraceSummary *bool `json:"local_trace_summary,omitempty" yaml:"local_trace_summary,omitempty"`
+	// LocalUIAddr corresponds to HONEYCOMB_LOCAL_UI_ADDR.
+	LocalUIAddr string `json:"local_ui_addr,omitempty" yaml:"local_ui_addr,omitempty"`
+	// LocalUIMaxTraces corresponds to HONEYCOMB_LOCAL_UI_MAX_TRACES.
+	LocalUIMaxTraces *int `json:"local_ui_max_traces,omitempty" yaml:"local_ui_max_traces,omitempty"`
+}
+
+// LoadConfigFile reads and validates a configuration file.
+//
+// Files ending in .json are parsed as JSON, all others as YAML. Unknown keys are errors, so that
+// misspelled settings aren't silently ignored.
+func LoadConfigFile(path string) (ConfigFile, error) {
+	var config ConfigFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("unable to read config file: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&config)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&config)
+	}
+	// an empty file is an empty configuration
+	if err != nil && !errors.Is(err, io.EOF) {
+		return config, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return config, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// validate returns an error describing each invalid setting, named by its path in the file.
+func (f ConfigFile) validate() error {
+	var errs []error
+	invalid := func(key string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	checkEndpoint := func(key string, endpoint string) {
+		if endpoint == "" {
+			return
+		}
+		if !isValidEndpoint(endpoint) {
+			invalid(key, "%q is not a valid endpoint", endpoint)
+		}
+	}
+
+	checkEndpoint("endpoint", f.Endpoint)
+	checkEndpoint("traces.endpoint", f.Traces.Endpoint)
+	checkEndpoint("metrics.endpoint", f.Metrics.Endpoint)
+	switch otelconfig.Protocol(f.Protocol) {
+	case "", otelconfig.ProtocolGRPC, otelconfig.ProtocolHTTPProto:
+	default:
+		invalid("protocol", "%q is not one of grpc or http/protobuf", f.Protocol)
+	}
+	if rate := f.Sampling.SampleRate; rate != nil && *rate < 0 {
+		invalid("sampling.sample_rate", "must be positive, got %d", *rate)
+	}
+	if eps := f.Sampling.TargetEPS; eps != nil && *eps < 0 {
+		invalid("sampling.target_eps", "must be positive, got %v", *eps)
+	}
+	if f.Sampling.ReloadInterval != "" {
+		if _, err := time.ParseDuration(f.Sampling.ReloadInterval); err != nil {
+			invalid("sampling.reload_interval", "%q is not a duration such as \"30s\"", f.Sampling.ReloadInterval)
+		}
+	}
+	if maxTraces := f.Processors.LocalUIMaxTraces; maxTraces != nil && *maxTraces < 0 {
+		invalid("processors.local_ui_max_traces", "must be positive, got %d", *maxTraces)
+	}
+	return errors.Join(errs...)
+}
+
+// isValidEndpoint reports whether endpoint is a URL or host, with an optional port.
+func isValidEndpoint(endpoint string) bool {
+	if strings.ContainsAny(endpoint, " \t\r\n") {
+		return false
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	return err == nil && u.Hostname() != ""
+}
+
+// settings returns the file's settings keyed by the environment variables that override them.
+func (f ConfigFile) settings() configSettings {
+	settings := configSettings{}
+	set := func(name string, value string) {
+		if value != "" {
+			settings[name] = value
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			settings[name] = strconv.FormatBool(*value)
+		}
+	}
+	setInt := func(name string, value *int) {
+		if value != nil {
+			settings[name] = strconv.Itoa(*value)
+		}
+	}
+
+	set("OTEL_SERVICE_NAME", f.ServiceName)
+	set("HONEYCOMB_API_ENDPOINT", f.Endpoint)
+	set("OTEL_EXPORTER_OTLP_PROTOCOL", f.Protocol)
+	setBool("OTEL_EXPORTER_OTLP_INSECURE", f.Insecure)
+	set("HONEYCOMB_API_KEY", f.ApiKey)
+	set("HONEYCOMB_DATASET", f.Dataset)
+	setBool("DEBUG", f.Debug)
+	setBool("HONEYCOMB_STRICT_CONFIG", f.Strict)
+	set("HONEYCOMB_TRACES_API_ENDPOINT", f.Traces.Endpoint)
+	set("HONEYCOMB_TRACES_APIKEY", f.Traces.ApiKey)
+	set("HONEYCOMB_TRACES_DATASET", f.Traces.Dataset)
+	setBool("OTEL_METRICS_ENABLED", f.Metrics.Enabled)
+	set("HONEYCOMB_METRICS_API_ENDPOINT", f.Metrics.Endpoint)
+	set("HONEYCOMB_METRICS_APIKEY", f.Metrics.ApiKey)
+	set("HONEYCOMB_METRICS_DATASET", f.Metrics.Dataset)
+	setInt("SAMPLE_RATE", f.Sampling.SampleRate)
+	if f.Sampling.TargetEPS != nil {
+		settings["HONEYCOMB_SAMPLER_TARGET_EPS"] = strconv.FormatFloat(*f.Sampling.TargetEPS, 'f', -1, 64)
+	}
+	set("HONEYCOMB_SAMPLER_RULES_FILE", f.Sampling.RulesFile)
+	set("HONEYCOMB_SAMPLER_RELOAD_INTERVAL", f.Sampling.ReloadInterval)
+	setBool("HONEYCOMB_SAMPLER_PARENT_BASED", f.Sampling.ParentBased)
+	setBool("HONEYCOMB_SAMPLER_ERROR_BIASED", f.Sampling.ErrorBiased)
+	setBool("HONEYCOMB_ENABLE_LOCAL_VISUALIZATIONS", f.Processors.LocalVisualizations)
+	setBool("HONEYCOMB_ENABLE_LOCAL_TRACE_SUMMARY", f.Processors.LocalTraceSummary)
+	set("HONEYCOMB_LOCAL_UI_ADDR", f.Processors.LocalUIAddr)
+	setInt("HONEYCOMB_LOCAL_UI_MAX_TRACES", f.Processors.LocalUIMaxTraces)
+	return settings
+}
+
+// configSettings looks up settings by environment variable name, falling back to the values
+// from a config file when the environment variable is not set.
+type configSettings map[string]string
+
+func (s configSettings) get(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return s[name]
+}
+
+// loadConfigSettings loads the config file set with HONEYCOMB_CONFIG_FILE, if any. When the file
+// can't be loaded, it returns settings from the environment only along with the error.
+func loadConfigSettings() (configSettings, error) {
+	path := os.Getenv("HONEYCOMB_CONFIG_FILE")
+	if path == "" {
+		return configSettings{}, nil
+	}
+	config, err := LoadConfigFile(path)
+	if err != nil {
+		return configSettings{}, err
+	}
+	return config.settings(), nil
+}
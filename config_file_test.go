@@ -0,0 +1,206 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, name string, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func TestLoadConfigFileYAML(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+service_name: checkout
+endpoint: https://api.eu1.honeycomb.io
+protocol: http/protobuf
+api_key: file-key
+debug: true
+traces:
+  dataset: traces-dataset
+metrics:
+  enabled: true
+  api_key: metrics-key
+sampling:
+  sample_rate: 10
+  reload_interval: 1m
+  parent_based: true
+processors:
+  local_ui_addr: localhost:7777
+`)
+
+	config, err := LoadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, configSettings{
+		"OTEL_SERVICE_NAME":                 "checkout",
+		"HONEYCOMB_API_ENDPOINT":            "https://api.eu1.honeycomb.io",
+		"OTEL_EXPORTER_OTLP_PROTOCOL":       "http/protobuf",
+		"HONEYCOMB_API_KEY":                 "file-key",
+		"DEBUG":                             "true",
+		"HONEYCOMB_TRACES_DATASET":          "traces-dataset",
+		"OTEL_METRICS_ENABLED":              "true",
+		"HONEYCOMB_METRICS_APIKEY":          "metrics-key",
+		"SAMPLE_RATE":                       "10",
+		"HONEYCOMB_SAMPLER_RELOAD_INTERVAL": "1m",
+		"HONEYCOMB_SAMPLER_PARENT_BASED":    "true",
+		"HONEYCOMB_LOCAL_UI_ADDR":           "localhost:7777",
+	}, config.settings())
+}
+
+func TestLoadConfigFileJSON(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"api_key": "file-key", "sampling": {"target_eps": 2.5}}`)
+
+	config, err := LoadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "file-key", config.ApiKey)
+	assert.Equal(t, "2.5", config.settings()["HONEYCOMB_SAMPLER_TARGET_EPS"])
+}
+
+func TestLoadConfigFileRejectsUnknownKeys(t *testing.T) {
+	_, err := LoadConfigFile(writeConfigFile(t, "config.yaml", "apikey: typo\n"))
+	assert.ErrorContains(t, err, "field apikey not found")
+
+	_, err = LoadConfigFile(writeConfigFile(t, "config.json", `{"sampling": {"rate": 5}}`))
+	assert.ErrorContains(t, err, `unknown field "rate"`)
+}
+
+func TestLoadConfigFileReportsEachInvalidSetting(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+endpoint: "not a host"
+protocol: udp
+traces:
+  endpoint: api.honeycomb.io:443
+sampling:
+  sample_rate: -1
+  reload_interval: soon
+`)
+
+	_, err := LoadConfigFile(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `endpoint: "not a host" is not a valid endpoint`)
+	assert.Contains(t, err.Error(), `protocol: "udp" is not one of grpc or http/protobuf`)
+	assert.Contains(t, err.Error(), "sampling.sample_rate: must be positive, got -1")
+	assert.Contains(t, err.Error(), `sampling.reload_interval: "soon" is not a duration`)
+	assert.NotContains(t, err.Error(), "traces.endpoint")
+
+	// otelconfig can't export with http/json
+	_, err = LoadConfigFile(writeConfigFile(t, "json.yaml", "protocol: http/json\n"))
+	assert.ErrorContains(t, err, `protocol: "http/json" is not one of grpc or http/protobuf`)
+}
+
+func TestLoadConfigFileAllowsEmptyFile(t *testing.T) {
+	config, err := LoadConfigFile(writeConfigFile(t, "config.yaml", ""))
+	require.NoError(t, err)
+	assert.Empty(t, config.settings())
+}
+
+func TestEnvironmentVariablesOverrideConfigFile(t *testing.T) {
+	t.Setenv("HONEYCOMB_CONFIG_FILE", writeConfigFile(t, "config.yaml", `
+service_name: from-file
+api_key: file-key
+dataset: file-dataset
+endpoint: file-endpoint:443
+`))
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	t.Setenv("HONEYCOMB_API_KEY", "env-key")
+	config := freshConfig()
+
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+
+	assert.Equal(t, "env-key", config.Headers[honeycombApiKeyHeader])
+	assert.Equal(t, "file-dataset", config.Headers[honeycombDatasetHeader])
+	assert.Equal(t, "file-endpoint:443", config.ExporterEndpoint)
+	assert.Equal(t, "from-file", config.ServiceName)
+	assert.Empty(t, takeConfigState(config).problems)
+}
+
+func TestInvalidConfigFileIsReportedByValidation(t *testing.T) {
+	t.Setenv("HONEYCOMB_CONFIG_FILE", writeConfigFile(t, "config.yaml", "api_key: file-key\nsampling:\n  sample_rate: -1\n"))
+	t.Setenv("HONEYCOMB_API_KEY", "123456789012345678901")
+	config := freshConfig()
+	logger := &warnCaptureLogger{}
+	config.Logger = logger
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+
+	// the file is ignored, with a warning
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, "123456789012345678901", config.Headers[honeycombApiKeyHeader])
+	assert.Equal(t, configFileInvalidMessage, logger.WarnFormat)
+	assert.Equal(t, "HONEYCOMB_CONFIG_FILE", logger.WarnValues[0])
+	assert.ErrorContains(t, logger.WarnValues[1].(error), "sampling.sample_rate: must be positive")
+
+	// or returned with strict validation
+	useValidateConfig(t)
+	t.Setenv("HONEYCOMB_STRICT_CONFIG", "true")
+	shutdown, err := otelconfig.ConfigureOpenTelemetry()
+	if shutdown != nil {
+		defer shutdown()
+	}
+	assert.ErrorContains(t, err, "sampling.sample_rate: must be positive")
+}
+
+func TestConfigFileZeroValuesAreSettings(t *testing.T) {
+	config, err := LoadConfigFile(writeConfigFile(t, "config.yaml", "sampling:\n  sample_rate: 0\n  target_eps: 0\nprocessors:\n  local_ui_max_traces: 0\n"))
+	require.NoError(t, err)
+	assert.Equal(t, configSettings{
+		"SAMPLE_RATE":                   "0",
+		"HONEYCOMB_SAMPLER_TARGET_EPS":  "0",
+		"HONEYCOMB_LOCAL_UI_MAX_TRACES": "0",
+	}, config.settings())
+}
+
+func TestConfigFileCanDisableTracesWithoutChangingTheEnvironment(t *testing.T) {
+	useValidateConfig(t)
+	t.Setenv("HONEYCOMB_CONFIG_FILE", writeConfigFile(t, "config.yaml", "api_key: file-key\n"))
+	t.Setenv("OTEL_EXPERIMENTAL_CONFIG_FILE", writeConfigFile(t, "otel.yaml", "file_format: \"0.3\"\ndisabled: true\n"))
+	t.Setenv("OTEL_TRACES_ENABLED", "")
+	os.Unsetenv("OTEL_TRACES_ENABLED")
+
+	var tracesEnabled bool
+	previous := otelconfig.ValidateConfig
+	otelconfig.ValidateConfig = func(c *otelconfig.Config) error {
+		err := previous(c)
+		tracesEnabled = c.TracesEnabled
+		return err
+	}
+	shutdown, err := otelconfig.ConfigureOpenTelemetry()
+	require.NoError(t, err)
+	defer shutdown()
+	assert.False(t, tracesEnabled)
+	_, set := os.LookupEnv("OTEL_TRACES_ENABLED")
+	assert.False(t, set)
+}
+
+func TestServiceNameFromEnvironmentIsLeftToOtelconfig(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "from-env")
+	config := freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	assert.Empty(t, config.ServiceName)
+}
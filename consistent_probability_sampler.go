@@ -0,0 +1,188 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// otelTraceStateKey is the W3C tracestate entry reserved for OpenTelemetry.
+	otelTraceStateKey = "ot"
+	// thresholdSubkey and randomnessSubkey are the sampling subkeys within the ot tracestate entry.
+	thresholdSubkey  = "th"
+	randomnessSubkey = "rv"
+
+	// randomnessBits is the number of bits of randomness used for consistent probability sampling.
+	randomnessBits = 56
+	// maxThreshold is the exclusive upper bound for thresholds and randomness values.
+	maxThreshold    = uint64(1) << randomnessBits
+	randomnessMask  = maxThreshold - 1
+	thresholdDigits = randomnessBits / 4
+)
+
+// ConsistentProbabilitySampler implements OpenTelemetry's consistent probability sampling, where
+// a span is sampled when the trace's 56-bit randomness value is at least the sampling threshold,
+// and the threshold is propagated as "th" in the "ot" tracestate entry. Sampling decisions agree
+// with other OpenTelemetry SDKs using the same algorithm, and the adjusted count implied by the
+// threshold is recorded on kept spans using the SampleRate attribute.
+type ConsistentProbabilitySampler struct {
+	threshold           uint64
+	sampleRateAttribute attribute.KeyValue
+}
+
+var _ trace.Sampler = ConsistentProbabilitySampler{}
+
+// Returns a new ConsistentProbabilitySampler keeping, on average, 1 in sampleRate traces.
+//
+// Spans whose parent is not sampled are dropped, and spans whose sampled parent carries a
+// threshold use that threshold's sample rate. Other spans are sampled using the randomness
+// value from the parent's tracestate ("rv"), or the lowest 56 bits of the trace ID.
+func NewConsistentProbabilitySampler(sampleRate int) ConsistentProbabilitySampler {
+	threshold := maxThreshold
+	if sampleRate >= 1 {
+		threshold = maxThreshold - maxThreshold/uint64(sampleRate)
+	}
+	return ConsistentProbabilitySampler{
+		threshold:           threshold,
+		sampleRateAttribute: sampleRateAttributeKey.Int(sampleRate),
+	}
+}
+
+// WithConsistentProbabilitySampler() sets the sampler used to sample trace spans to a
+// ConsistentProbabilitySampler using a Honeycomb sample rate. Like the other Honeycomb samplers,
+// it replaces a sampler set with WithSampler() whichever option is applied last.
+func WithConsistentProbabilitySampler(sampleRate int) otelconfig.Option {
+	return withFinalSampler(NewConsistentProbabilitySampler(sampleRate))
+}
+
+func (cs ConsistentProbabilitySampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
+	parent := oteltrace.SpanContextFromContext(parameters.ParentContext)
+	ts := parent.TraceState()
+	otValue := ts.Get(otelTraceStateKey)
+
+	if parent.IsValid() {
+		if !parent.IsSampled() {
+			return trace.SamplingResult{Decision: trace.Drop, Tracestate: ts}
+		}
+		if th, ok := parseThreshold(otSubkey(otValue, thresholdSubkey)); ok {
+			result := trace.SamplingResult{Decision: trace.RecordAndSample, Tracestate: ts}
+			if th < maxThreshold {
+				result.Attributes = []attribute.KeyValue{sampleRateAttributeKey.Int(sampleRateForThreshold(th))}
+			}
+			return result
+		}
+	}
+
+	randomness, ok := parseRandomness(otSubkey(otValue, randomnessSubkey))
+	if !ok {
+		randomness = binary.BigEndian.Uint64(parameters.TraceID[8:16]) & randomnessMask
+	}
+
+	if cs.threshold >= maxThreshold || randomness < cs.threshold {
+		return trace.SamplingResult{
+			Decision:   trace.Drop,
+			Tracestate: withOTSubkey(ts, otValue, thresholdSubkey, ""),
+		}
+	}
+	return trace.SamplingResult{
+		Decision:   trace.RecordAndSample,
+		Attributes: []attribute.KeyValue{cs.sampleRateAttribute},
+		Tracestate: withOTSubkey(ts, otValue, thresholdSubkey, formatThreshold(cs.threshold)),
+	}
+}
+
+func (cs ConsistentProbabilitySampler) Description() string {
+	return "ConsistentProbabilitySampler"
+}
+
+// sampleRateForThreshold returns the adjusted count implied by a threshold, rounded to the nearest integer.
+func sampleRateForThreshold(threshold uint64) int {
+	return int(math.Round(float64(maxThreshold) / float64(maxThreshold-threshold)))
+}
+
+// formatThreshold encodes a threshold as up to 14 hex digits with trailing zeros removed.
+func formatThreshold(threshold uint64) string {
+	encoded := strings.TrimRight(fmt.Sprintf("%0*x", thresholdDigits, threshold), "0")
+	if encoded == "" {
+		return "0"
+	}
+	return encoded
+}
+
+// parseThreshold decodes a threshold of 1 to 14 hex digits, padding it with trailing zeros.
+func parseThreshold(value string) (uint64, bool) {
+	if value == "" || len(value) > thresholdDigits {
+		return 0, false
+	}
+	threshold, err := strconv.ParseUint(value+strings.Repeat("0", thresholdDigits-len(value)), 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return threshold, true
+}
+
+// parseRandomness decodes an explicit randomness value of exactly 14 hex digits.
+func parseRandomness(value string) (uint64, bool) {
+	if len(value) != thresholdDigits {
+		return 0, false
+	}
+	randomness, err := strconv.ParseUint(value, 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return randomness, true
+}
+
+// otSubkey returns the value of a subkey within an ot tracestate value such as "th:8;rv:0123456789abcd".
+func otSubkey(otValue string, key string) string {
+	for _, field := range strings.Split(otValue, ";") {
+		if k, v, ok := strings.Cut(field, ":"); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// withOTSubkey returns ts with a subkey of its ot entry set to value, or removed if value is empty.
+func withOTSubkey(ts oteltrace.TraceState, otValue string, key string, value string) oteltrace.TraceState {
+	fields := []string{}
+	if value != "" {
+		fields = append(fields, key+":"+value)
+	}
+	for _, field := range strings.Split(otValue, ";") {
+		if k, _, ok := strings.Cut(field, ":"); ok && k != key {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return ts.Delete(otelTraceStateKey)
+	}
+	updated, err := ts.Insert(otelTraceStateKey, strings.Join(fields, ";"))
+	if err != nil {
+		return ts
+	}
+	return updated
+}
@@ -0,0 +1,144 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestConsistentProbabilityThresholdEncoding(t *testing.T) {
+	testCases := []struct {
+		sampleRate int
+		encoded    string
+	}{
+		{sampleRate: 1, encoded: "0"},
+		{sampleRate: 2, encoded: "8"},
+		{sampleRate: 4, encoded: "c"},
+		{sampleRate: 16, encoded: "f"},
+		{sampleRate: 10, encoded: "e6666666666667"},
+		{sampleRate: 1000, encoded: "ffbe76c8b43959"},
+	}
+	for _, tC := range testCases {
+		sampler := NewConsistentProbabilitySampler(tC.sampleRate)
+		assert.Equal(t, tC.encoded, formatThreshold(sampler.threshold))
+
+		threshold, ok := parseThreshold(tC.encoded)
+		assert.True(t, ok)
+		assert.Equal(t, tC.sampleRate, sampleRateForThreshold(threshold))
+	}
+
+	_, ok := parseThreshold("")
+	assert.False(t, ok)
+	_, ok = parseThreshold("123456789abcdef")
+	assert.False(t, ok)
+	_, ok = parseThreshold("xyz")
+	assert.False(t, ok)
+}
+
+func TestConsistentProbabilitySamplerRootDecisions(t *testing.T) {
+	sampler := NewConsistentProbabilitySampler(2)
+	assert.Equal(t, "ConsistentProbabilitySampler", sampler.Description())
+
+	// randomness is the lowest 56 bits of the trace ID
+	high := oteltrace.TraceID{0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	low := oteltrace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	result := sampler.ShouldSample(trace.SamplingParameters{ParentContext: context.Background(), TraceID: high})
+	assert.Equal(t, trace.RecordAndSample, result.Decision)
+	assert.Equal(t, "th:8", result.Tracestate.Get("ot"))
+	attr := getAttributeWithKey(result.Attributes, "SampleRate")
+	if attr == nil {
+		t.Fatalf("SampleRate attribute was not found")
+	}
+	assert.Equal(t, int64(2), attr.Value.AsInt64())
+
+	result = sampler.ShouldSample(trace.SamplingParameters{ParentContext: context.Background(), TraceID: low})
+	assert.Equal(t, trace.Drop, result.Decision)
+	assert.Equal(t, "", result.Tracestate.Get("ot"))
+
+	// sample rate 0 never samples
+	result = NewConsistentProbabilitySampler(0).ShouldSample(trace.SamplingParameters{ParentContext: context.Background(), TraceID: high})
+	assert.Equal(t, trace.Drop, result.Decision)
+}
+
+func TestConsistentProbabilitySamplerWithParents(t *testing.T) {
+	sampler := NewConsistentProbabilitySampler(2)
+
+	testCases := []struct {
+		desc               string
+		sampled            bool
+		tracestate         string
+		expectedDecision   trace.SamplingDecision
+		expectedOT         string
+		expectedSampleRate int64
+	}{
+		{
+			desc:               "sampled parent with threshold",
+			sampled:            true,
+			tracestate:         "ot=th:c",
+			expectedDecision:   trace.RecordAndSample,
+			expectedOT:         "th:c",
+			expectedSampleRate: 4,
+		},
+		{
+			desc:               "sampled parent with explicit randomness",
+			sampled:            true,
+			tracestate:         "ot=rv:ffffffffffffff,vendor=value",
+			expectedDecision:   trace.RecordAndSample,
+			expectedOT:         "th:8;rv:ffffffffffffff",
+			expectedSampleRate: 2,
+		},
+		{
+			desc:             "explicit randomness below threshold",
+			sampled:          true,
+			tracestate:       "ot=rv:00000000000000",
+			expectedDecision: trace.Drop,
+			expectedOT:       "rv:00000000000000",
+		},
+		{
+			desc:             "unsampled parent",
+			sampled:          false,
+			tracestate:       "ot=rv:ffffffffffffff",
+			expectedDecision: trace.Drop,
+			expectedOT:       "rv:ffffffffffffff",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctx := remoteParentContext(t, tC.sampled, tC.tracestate)
+			result := sampler.ShouldSample(trace.SamplingParameters{
+				ParentContext: ctx,
+				TraceID:       oteltrace.SpanContextFromContext(ctx).TraceID(),
+			})
+			assert.Equal(t, tC.expectedDecision, result.Decision)
+			assert.Equal(t, tC.expectedOT, result.Tracestate.Get("ot"))
+
+			attr := getAttributeWithKey(result.Attributes, "SampleRate")
+			if tC.expectedSampleRate == 0 {
+				assert.Nil(t, attr)
+				return
+			}
+			if attr == nil {
+				t.Fatalf("SampleRate attribute was not found")
+			}
+			assert.Equal(t, tC.expectedSampleRate, attr.Value.AsInt64())
+		})
+	}
+}
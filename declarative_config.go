@@ -0,0 +1,520 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// declarativeConfig is the subset of the OpenTelemetry declarative configuration file format,
+// set with OTEL_EXPERIMENTAL_CONFIG_FILE, that the distro understands. Sections for other
+// signals and instrumentation are ignored, so that one file can configure SDKs in several
+// languages. Honeycomb specific settings go in a "honeycomb" section using the same format as
+// HONEYCOMB_CONFIG_FILE.
+// supportedDeclarativeFileFormats are the versions of the file format the mapping below follows.
+var supportedDeclarativeFileFormats = map[string]bool{"0.3": true, "0.4": true}
+
+type declarativeConfig struct {
+	FileFormat     string                    `yaml:"file_format"`
+	Disabled       bool                      `yaml:"disabled"`
+	Resource       declarativeResource       `yaml:"resource"`
+	Propagator     declarativePropagator     `yaml:"propagator"`
+	TracerProvider declarativeTracerProvider `yaml:"tracer_provider"`
+	MeterProvider  *declarativeMeterProvider `yaml:"meter_provider"`
+	Honeycomb      yaml.Node                 `yaml:"honeycomb"`
+}
+
+type declarativeResource struct {
+	Attributes     declarativeKeyValues `yaml:"attributes"`
+	AttributesList string               `yaml:"attributes_list"`
+}
+
+type declarativePropagator struct {
+	Composite     declarativeNames `yaml:"composite"`
+	CompositeList string           `yaml:"composite_list"`
+}
+
+type declarativeTracerProvider struct {
+	Processors []declarativeSpanProcessor `yaml:"processors"`
+	Sampler    declarativeSampler         `yaml:"sampler"`
+}
+
+type declarativeSpanProcessor struct {
+	Batch  *declarativeProcessorExporter `yaml:"batch"`
+	Simple *declarativeProcessorExporter `yaml:"simple"`
+}
+
+type declarativeProcessorExporter struct {
+	Exporter declarativeExporter `yaml:"exporter"`
+}
+
+type declarativeMeterProvider struct {
+	Readers []declarativeMetricReader `yaml:"readers"`
+}
+
+type declarativeMetricReader struct {
+	Periodic *declarativePeriodicReader `yaml:"periodic"`
+}
+
+type declarativePeriodicReader struct {
+	// Interval is in milliseconds.
+	Interval int                 `yaml:"interval"`
+	Exporter declarativeExporter `yaml:"exporter"`
+}
+
+// declarativeExporter is keyed by the exporter type, such as otlp or console.
+type declarativeExporter map[string]*declarativeOTLPExporter
+
+type declarativeOTLPExporter struct {
+	Protocol    string               `yaml:"protocol"`
+	Encoding    string               `yaml:"encoding"`
+	Endpoint    string               `yaml:"endpoint"`
+	Insecure    bool                 `yaml:"insecure"`
+	Headers     declarativeKeyValues `yaml:"headers"`
+	HeadersList string               `yaml:"headers_list"`
+}
+
+// declarativeSampler is keyed by the sampler type, such as parent_based or always_on.
+type declarativeSampler map[string]yaml.Node
+
+// declarativeKeyValues is a list of name and value pairs, as used for headers and resource
+// attributes, or a mapping as used by earlier versions of the file format.
+type declarativeKeyValues map[string]string
+
+func (kv *declarativeKeyValues) UnmarshalYAML(node *yaml.Node) error {
+	values := declarativeKeyValues{}
+	switch node.Kind {
+	case yaml.SequenceNode:
+		var pairs []struct {
+			Name  string      `yaml:"name"`
+			Value interface{} `yaml:"value"`
+		}
+		if err := node.Decode(&pairs); err != nil {
+			return err
+		}
+		for _, pair := range pairs {
+			values[pair.Name] = fmt.Sprint(pair.Value)
+		}
+	default:
+		var mapping map[string]interface{}
+		if err := node.Decode(&mapping); err != nil {
+			return err
+		}
+		for name, value := range mapping {
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	*kv = values
+	return nil
+}
+
+// declarativeNames is a list of names, or of single key mappings as in `- tracecontext: {}`.
+type declarativeNames []string
+
+func (n *declarativeNames) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: expected a list", node.Line)
+	}
+	var names declarativeNames
+	for _, item := range node.Content {
+		switch {
+		case item.Kind == yaml.ScalarNode:
+			names = append(names, item.Value)
+		case item.Kind == yaml.MappingNode && len(item.Content) == 2:
+			names = append(names, item.Content[0].Value)
+		default:
+			return fmt.Errorf("line %d: expected a name", item.Line)
+		}
+	}
+	*n = names
+	return nil
+}
+
+// loadDeclarativeConfig loads the OpenTelemetry declarative configuration file set with
+// OTEL_EXPERIMENTAL_CONFIG_FILE, if any, returning the options it sets along with settings
+// keyed by the environment variables that override them.
+func loadDeclarativeConfig() ([]otelconfig.Option, configSettings, error) {
+	path := os.Getenv("OTEL_EXPERIMENTAL_CONFIG_FILE")
+	if path == "" {
+		return nil, configSettings{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, configSettings{}, fmt.Errorf("unable to read OpenTelemetry config file: %w", err)
+	}
+	opts, settings, err := parseDeclarativeConfig(data)
+	if err != nil {
+		return nil, configSettings{}, fmt.Errorf("invalid OpenTelemetry config file %s: %w", path, err)
+	}
+	return opts, settings, nil
+}
+
+func parseDeclarativeConfig(data []byte) ([]otelconfig.Option, configSettings, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, err
+	}
+	substituteEnvVars(&root)
+	var config declarativeConfig
+	if err := root.Decode(&config); err != nil {
+		return nil, nil, err
+	}
+	if config.FileFormat == "" {
+		return nil, nil, errors.New("file_format is required")
+	}
+	if !supportedDeclarativeFileFormats[config.FileFormat] {
+		return nil, nil, fmt.Errorf("file_format %q is not supported, use 0.3 or 0.4", config.FileFormat)
+	}
+	return config.mapping()
+}
+
+// mapping returns the options and settings that the file's sections correspond to.
+func (f declarativeConfig) mapping() ([]otelconfig.Option, configSettings, error) {
+	var opts []otelconfig.Option
+	settings := configSettings{}
+
+	if f.Disabled {
+		settings["OTEL_TRACES_ENABLED"] = "false"
+		settings["OTEL_METRICS_ENABLED"] = "false"
+	}
+
+	attributes := parseKeyValueList(f.Resource.AttributesList)
+	for name, value := range f.Resource.Attributes {
+		attributes[name] = value
+	}
+	if serviceName, ok := attributes["service.name"]; ok {
+		settings["OTEL_SERVICE_NAME"] = serviceName
+		delete(attributes, "service.name")
+	}
+	if len(attributes) > 0 {
+		opts = append(opts, otelconfig.WithResourceAttributes(attributes))
+	}
+
+	propagators := []string(f.Propagator.Composite)
+	for _, name := range strings.Split(f.Propagator.CompositeList, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			propagators = append(propagators, name)
+		}
+	}
+	if len(propagators) > 0 {
+		opts = append(opts, otelconfig.WithPropagators(propagators))
+	}
+
+	var errs []error
+	otlpExporters := 0
+	for i, processor := range f.TracerProvider.Processors {
+		key := fmt.Sprintf("tracer_provider.processors[%d]", i)
+		holder := processor.Batch
+		if holder == nil {
+			holder = processor.Simple
+		}
+		if holder == nil {
+			errs = append(errs, fmt.Errorf("%s: only batch and simple processors are supported", key))
+			continue
+		}
+		for name, exporter := range holder.Exporter {
+			switch name {
+			case "console":
+				opts = append(opts, WithDebugSpanExporter())
+			case "otlp", "otlp_http", "otlp_grpc":
+				if otlpExporters++; otlpExporters > 1 {
+					errs = append(errs, fmt.Errorf("%s: only one OTLP span exporter is supported", key))
+					continue
+				}
+				exporterOpts, err := exporter.tracesMapping(name, settings)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s.exporter.%s: %w", key, name, err))
+				}
+				opts = append(opts, exporterOpts...)
+			default:
+				errs = append(errs, fmt.Errorf("%s: %q exporters are not supported", key, name))
+			}
+		}
+	}
+
+	if len(f.TracerProvider.Sampler) > 0 {
+		samplerOpts, err := f.TracerProvider.Sampler.mapping(settings)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tracer_provider.sampler: %w", err))
+		}
+		opts = append(opts, samplerOpts...)
+	}
+
+	if f.MeterProvider != nil && !f.Disabled {
+		for i, reader := range f.MeterProvider.Readers {
+			key := fmt.Sprintf("meter_provider.readers[%d]", i)
+			if reader.Periodic == nil {
+				errs = append(errs, fmt.Errorf("%s: only periodic readers are supported", key))
+				continue
+			}
+			if i > 0 {
+				errs = append(errs, fmt.Errorf("%s: only one metric reader is supported", key))
+				continue
+			}
+			settings["OTEL_METRICS_ENABLED"] = "true"
+			if reader.Periodic.Interval > 0 {
+				opts = append(opts, otelconfig.WithMetricsReportingPeriod(time.Duration(reader.Periodic.Interval)*time.Millisecond))
+			}
+			for name, exporter := range reader.Periodic.Exporter {
+				if name != "otlp" && name != "otlp_http" && name != "otlp_grpc" {
+					errs = append(errs, fmt.Errorf("%s: %q exporters are not supported", key, name))
+					continue
+				}
+				exporterOpts, err := exporter.metricsMapping(name, settings)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s.exporter.%s: %w", key, name, err))
+				}
+				opts = append(opts, exporterOpts...)
+			}
+		}
+	}
+
+	// settings in the honeycomb section take precedence over the standard sections
+	if !f.Honeycomb.IsZero() {
+		honeycomb, err := decodeHoneycombSection(&f.Honeycomb)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for name, value := range honeycomb.settings() {
+			settings[name] = value
+		}
+	}
+	return opts, settings, errors.Join(errs...)
+}
+
+// decodeHoneycombSection decodes the honeycomb extension section, rejecting unknown keys.
+func decodeHoneycombSection(node *yaml.Node) (ConfigFile, error) {
+	var config ConfigFile
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return config, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return ConfigFile{}, fmt.Errorf("honeycomb: %w", err)
+	}
+	if err := config.validate(); err != nil {
+		return ConfigFile{}, fmt.Errorf("honeycomb: %w", err)
+	}
+	return config, nil
+}
+
+func (e *declarativeOTLPExporter) tracesMapping(name string, settings configSettings) ([]otelconfig.Option, error) {
+	if e == nil {
+		e = &declarativeOTLPExporter{}
+	}
+	protocol, err := e.protocol(name)
+	if err != nil {
+		return nil, err
+	}
+	var opts []otelconfig.Option
+	if protocol != "" {
+		opts = append(opts, otelconfig.WithTracesExporterProtocol(protocol))
+	}
+	if e.Endpoint != "" {
+		settings["HONEYCOMB_TRACES_API_ENDPOINT"] = strings.TrimSuffix(e.Endpoint, "/v1/traces")
+	}
+	if e.Insecure || strings.HasPrefix(e.Endpoint, "http://") {
+		opts = append(opts, otelconfig.WithTracesExporterInsecure(true))
+	}
+	headers := e.headers()
+	if apikey, ok := headers[honeycombApiKeyHeader]; ok {
+		settings["HONEYCOMB_TRACES_APIKEY"] = apikey
+		delete(headers, honeycombApiKeyHeader)
+	}
+	if dataset, ok := headers[honeycombDatasetHeader]; ok {
+		settings["HONEYCOMB_TRACES_DATASET"] = dataset
+		delete(headers, honeycombDatasetHeader)
+	}
+	if len(headers) > 0 {
+		opts = append(opts, otelconfig.WithTracesHeaders(headers))
+	}
+	return opts, nil
+}
+
+func (e *declarativeOTLPExporter) metricsMapping(name string, settings configSettings) ([]otelconfig.Option, error) {
+	if e == nil {
+		e = &declarativeOTLPExporter{}
+	}
+	protocol, err := e.protocol(name)
+	if err != nil {
+		return nil, err
+	}
+	var opts []otelconfig.Option
+	if protocol != "" {
+		opts = append(opts, otelconfig.WithMetricsExporterProtocol(protocol))
+	}
+	if e.Endpoint != "" {
+		settings["HONEYCOMB_METRICS_API_ENDPOINT"] = strings.TrimSuffix(e.Endpoint, "/v1/metrics")
+	}
+	if e.Insecure || strings.HasPrefix(e.Endpoint, "http://") {
+		opts = append(opts, otelconfig.WithMetricsExporterInsecure(true))
+	}
+	headers := e.headers()
+	if apikey, ok := headers[honeycombApiKeyHeader]; ok {
+		settings["HONEYCOMB_METRICS_APIKEY"] = apikey
+		delete(headers, honeycombApiKeyHeader)
+	}
+	if dataset, ok := headers[honeycombDatasetHeader]; ok {
+		settings["HONEYCOMB_METRICS_DATASET"] = dataset
+		delete(headers, honeycombDatasetHeader)
+	}
+	if len(headers) > 0 {
+		opts = append(opts, otelconfig.WithMetricsHeaders(headers))
+	}
+	return opts, nil
+}
+
+// protocol returns the protocol for an exporter of the named type, if it is set.
+func (e *declarativeOTLPExporter) protocol(name string) (otelconfig.Protocol, error) {
+	switch name {
+	case "otlp_grpc":
+		return otelconfig.ProtocolGRPC, nil
+	case "otlp_http":
+		if e.Encoding != "" && e.Encoding != "protobuf" {
+			return "", fmt.Errorf("encoding %q is not supported, only protobuf", e.Encoding)
+		}
+		return otelconfig.ProtocolHTTPProto, nil
+	}
+	switch protocol := otelconfig.Protocol(e.Protocol); protocol {
+	case "", otelconfig.ProtocolGRPC, otelconfig.ProtocolHTTPProto:
+		return protocol, nil
+	default:
+		return "", fmt.Errorf("%q is not one of grpc or http/protobuf", e.Protocol)
+	}
+}
+
+// headers returns the exporter's headers with lower case names.
+func (e *declarativeOTLPExporter) headers() map[string]string {
+	headers := map[string]string{}
+	for name, value := range parseKeyValueList(e.HeadersList) {
+		headers[strings.ToLower(name)] = value
+	}
+	for name, value := range e.Headers {
+		headers[strings.ToLower(name)] = value
+	}
+	return headers
+}
+
+// mapping returns the options and settings for the sampler. Ratio based samplers use the
+// equivalent Honeycomb sample rate, rounded to the nearest whole number.
+func (s declarativeSampler) mapping(settings configSettings) ([]otelconfig.Option, error) {
+	if len(s) != 1 {
+		return nil, errors.New("expected exactly one sampler")
+	}
+	for name, node := range s {
+		switch name {
+		case "always_on":
+			settings["SAMPLE_RATE"] = "1"
+		case "always_off":
+			return []otelconfig.Option{withFinalSampler(trace.NeverSample())}, nil
+		case "trace_id_ratio_based":
+			var config struct {
+				Ratio *float64 `yaml:"ratio"`
+			}
+			if err := node.Decode(&config); err != nil {
+				return nil, err
+			}
+			ratio := 1.0
+			if config.Ratio != nil {
+				ratio = *config.Ratio
+			}
+			if ratio <= 0 {
+				return []otelconfig.Option{withFinalSampler(trace.NeverSample())}, nil
+			}
+			if ratio > 1 {
+				return nil, fmt.Errorf("ratio must be between 0 and 1, got %v", ratio)
+			}
+			settings["SAMPLE_RATE"] = strconv.Itoa(int(math.Round(1 / ratio)))
+		case "parent_based":
+			var config struct {
+				Root declarativeSampler `yaml:"root"`
+			}
+			if err := node.Decode(&config); err != nil {
+				return nil, err
+			}
+			settings["HONEYCOMB_SAMPLER_PARENT_BASED"] = "true"
+			if len(config.Root) == 0 {
+				settings["SAMPLE_RATE"] = "1"
+				return nil, nil
+			}
+			return config.Root.mapping(settings)
+		default:
+			return nil, fmt.Errorf("%q samplers are not supported", name)
+		}
+	}
+	return nil, nil
+}
+
+// parseKeyValueList parses a comma separated list of key=value pairs.
+func parseKeyValueList(list string) map[string]string {
+	values := map[string]string{}
+	for _, pair := range strings.Split(list, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); ok && key != "" {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+var envVarReference = regexp.MustCompile(`\$\$|\$\{(?:env:)?([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// substituteEnvVars replaces references to environment variables in the scalar values of node,
+// written as ${NAME}, ${env:NAME} or ${NAME:-default}. $$ escapes a literal $. Unquoted values
+// are typed by their substituted contents, so `sample_rate: ${RATE}` is a number.
+func substituteEnvVars(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			substituteEnvVars(child)
+		}
+	case yaml.MappingNode:
+		// only values, not keys
+		for i := 1; i < len(node.Content); i += 2 {
+			substituteEnvVars(node.Content[i])
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return
+		}
+		node.Value = envVarReference.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			if ref == "$$" {
+				return "$"
+			}
+			match := envVarReference.FindStringSubmatch(ref)
+			if value := os.Getenv(match[1]); value != "" {
+				return value
+			}
+			return match[2]
+		})
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+	}
+}
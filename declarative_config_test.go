@@ -0,0 +1,199 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDeclarativeConfig = `
+file_format: "0.3"
+resource:
+  attributes:
+    - name: service.name
+      value: checkout
+    - name: deployment.environment
+      value: ${DEPLOY_ENV:-dev}
+propagator:
+  composite: [tracecontext, baggage]
+tracer_provider:
+  processors:
+    - batch:
+        exporter:
+          otlp:
+            protocol: http/protobuf
+            endpoint: http://localhost:4318/v1/traces
+            headers:
+              - name: x-honeycomb-team
+                value: ${env:TEST_HONEYCOMB_KEY}
+              - name: x-custom
+                value: price is $$5
+  sampler:
+    parent_based:
+      root:
+        trace_id_ratio_based:
+          ratio: 0.1
+meter_provider:
+  readers:
+    - periodic:
+        interval: 60000
+        exporter:
+          otlp:
+            protocol: grpc
+            endpoint: https://api.honeycomb.io:443
+            headers_list: x-honeycomb-team=metrics-key,x-honeycomb-dataset=metrics
+logger_provider:
+  processors: []
+honeycomb:
+  debug: false
+  processors:
+    local_ui_max_traces: ${UI_TRACES:-50}
+`
+
+func TestParseDeclarativeConfig(t *testing.T) {
+	t.Setenv("TEST_HONEYCOMB_KEY", "traces-key")
+	t.Setenv("DEPLOY_ENV", "")
+
+	opts, settings, err := parseDeclarativeConfig([]byte(testDeclarativeConfig))
+	require.NoError(t, err)
+	assert.Equal(t, configSettings{
+		"OTEL_SERVICE_NAME":              "checkout",
+		"HONEYCOMB_TRACES_API_ENDPOINT":  "http://localhost:4318",
+		"HONEYCOMB_TRACES_APIKEY":        "traces-key",
+		"HONEYCOMB_SAMPLER_PARENT_BASED": "true",
+		"SAMPLE_RATE":                    "10",
+		"OTEL_METRICS_ENABLED":           "true",
+		"HONEYCOMB_METRICS_API_ENDPOINT": "https://api.honeycomb.io:443",
+		"HONEYCOMB_METRICS_APIKEY":       "metrics-key",
+		"HONEYCOMB_METRICS_DATASET":      "metrics",
+		"DEBUG":                          "false",
+		"HONEYCOMB_LOCAL_UI_MAX_TRACES":  "50",
+	}, settings)
+
+	config := freshConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+	assert.Equal(t, "dev", config.ResourceAttributes["deployment.environment"])
+	assert.Equal(t, []string{"tracecontext", "baggage"}, config.Propagators)
+	assert.Equal(t, otelconfig.ProtocolHTTPProto, config.TracesExporterProtocol)
+	assert.True(t, config.TracesExporterEndpointInsecure)
+	assert.Equal(t, map[string]string{"x-custom": "price is $5"}, config.TracesHeaders)
+	assert.Equal(t, otelconfig.ProtocolGRPC, config.MetricsExporterProtocol)
+	assert.Equal(t, time.Minute.String(), config.MetricsReportingPeriod)
+}
+
+func TestParseDeclarativeConfigSamplers(t *testing.T) {
+	testCases := []struct {
+		sampler  string
+		rate     string
+		never    bool
+		errorMsg string
+	}{
+		{sampler: "always_on:", rate: "1"},
+		{sampler: "always_off:", never: true},
+		{sampler: "trace_id_ratio_based:\n      ratio: 0.25", rate: "4"},
+		{sampler: "trace_id_ratio_based:\n      ratio: 0", never: true},
+		{sampler: "trace_id_ratio_based:\n      ratio: 2", errorMsg: "ratio must be between 0 and 1"},
+		{sampler: "jaeger_remote:\n      endpoint: localhost", errorMsg: `"jaeger_remote" samplers are not supported`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sampler, func(t *testing.T) {
+			opts, settings, err := parseDeclarativeConfig([]byte("file_format: \"0.3\"\ntracer_provider:\n  sampler:\n    " + tc.sampler + "\n"))
+			if tc.errorMsg != "" {
+				assert.ErrorContains(t, err, tc.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.rate, settings["SAMPLE_RATE"])
+			config := freshConfig()
+			for _, opt := range opts {
+				opt(config)
+			}
+			// a sample rate set afterwards, such as from SAMPLE_RATE, doesn't turn sampling back on
+			WithSampler(10)(config)
+			takeConfigState(config).applySamplers(config)
+			if tc.never {
+				require.NotNil(t, config.Sampler)
+				assert.Equal(t, "AlwaysOffSampler", config.Sampler.Description())
+			}
+		})
+	}
+}
+
+func TestParseDeclarativeConfigReportsErrors(t *testing.T) {
+	_, _, err := parseDeclarativeConfig([]byte("tracer_provider: {}\n"))
+	assert.ErrorContains(t, err, "file_format is required")
+
+	_, _, err = parseDeclarativeConfig([]byte("file_format: \"1.0\"\n"))
+	assert.ErrorContains(t, err, `file_format "1.0" is not supported`)
+
+	for _, exporter := range []string{"otlp:\n            protocol: http/json", "otlp_http:\n            encoding: json"} {
+		_, _, err = parseDeclarativeConfig([]byte(`
+file_format: "0.4"
+tracer_provider:
+  processors:
+    - batch:
+        exporter:
+          ` + exporter + "\n"))
+		assert.ErrorContains(t, err, "tracer_provider.processors[0]", exporter)
+	}
+
+	_, _, err = parseDeclarativeConfig([]byte(`
+file_format: "0.3"
+tracer_provider:
+  processors:
+    - batch:
+        exporter:
+          zipkin:
+            endpoint: http://localhost:9411
+honeycomb:
+  apikey: typo
+`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `tracer_provider.processors[0]: "zipkin" exporters are not supported`)
+	assert.Contains(t, err.Error(), "honeycomb: yaml: unmarshal errors")
+	assert.Contains(t, err.Error(), "field apikey not found")
+}
+
+func TestDeclarativeConfigIsOverriddenByHoneycombSettings(t *testing.T) {
+	t.Setenv("TEST_HONEYCOMB_KEY", "traces-key")
+	t.Setenv("OTEL_EXPERIMENTAL_CONFIG_FILE", writeConfigFile(t, "otel.yaml", testDeclarativeConfig))
+	t.Setenv("HONEYCOMB_CONFIG_FILE", writeConfigFile(t, "honeycomb.yaml", "traces:\n  dataset: from-honeycomb-file\n"))
+	t.Setenv("HONEYCOMB_TRACES_APIKEY", "env-key")
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	t.Setenv("OTEL_METRICS_ENABLED", "")
+	t.Setenv("HONEYCOMB_LOCAL_UI_MAX_TRACES", "")
+	config := freshConfig()
+
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+
+	assert.Equal(t, "env-key", config.TracesHeaders[honeycombApiKeyHeader])
+	assert.Equal(t, "from-honeycomb-file", config.TracesHeaders[honeycombDatasetHeader])
+	assert.Equal(t, "http://localhost:4318", config.TracesExporterEndpoint)
+	assert.Equal(t, "checkout", config.ServiceName)
+	assert.True(t, config.MetricsEnabled)
+	state := takeConfigState(config)
+	assert.Empty(t, state.problems)
+	state.applySamplers(config)
+	assert.Equal(t, "ParentBasedSampler{DeterministicSampler}", config.Sampler.Description())
+}
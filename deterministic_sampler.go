@@ -19,6 +19,8 @@ import (
 	"go.opentelemetry.io/otel/sdk/trace"
 )
 
+const sampleRateAttributeKey = attribute.Key("SampleRate")
+
 type DeterministicSampler struct {
 	innerSampler        trace.Sampler
 	sampleRateAttribute attribute.KeyValue
@@ -36,15 +38,14 @@ func NewDeterministicSampler(sampleRate int) DeterministicSampler {
 	}
 	return DeterministicSampler{
 		innerSampler:        innerSampler,
-		sampleRateAttribute: attribute.Int("SampleRate", sampleRate),
+		sampleRateAttribute: sampleRateAttributeKey.Int(sampleRate),
 	}
 }
 
 func (ds DeterministicSampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
 	result := ds.innerSampler.ShouldSample(parameters)
-	if result.Decision == trace.RecordAndSample {
-		result.Attributes = append(result.Attributes, ds.sampleRateAttribute)
-	}
+	// dropped spans have the sample rate too, so that it is known for every decision
+	result.Attributes = append(result.Attributes, ds.sampleRateAttribute)
 	return result
 }
 
@@ -70,20 +70,18 @@ func TestDeterministicSamplerSetup(t *testing.T) {
 			result := sampler.ShouldSample(trace.SamplingParameters{})
 			assert.Equal(t, tc.decision, result.Decision)
 
-			if tc.sampleRate > 0 {
-				attr := getAttributeWithKey(result.Attributes, "SampleRate")
-				if attr == nil {
-					t.Fatalf("SampleRate attribute was not found")
-				}
-				assert.Equal(t, int64(tc.sampleRate), attr.Value.AsInt64())
+			attr := getAttributeWithKey(result.Attributes, "SampleRate")
+			if attr == nil {
+				t.Fatalf("SampleRate attribute was not found")
 			}
+			assert.Equal(t, int64(tc.sampleRate), attr.Value.AsInt64())
 		})
 	}
 }
 
 func getAttributeWithKey(attrs []attribute.KeyValue, key string) *attribute.KeyValue {
 	for _, attr := range attrs {
-		if attr.Key == attribute.Key("SampleRate") {
+		if attr.Key == attribute.Key(key) {
 			return &attr
 		}
 	}
@@ -0,0 +1,245 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	defaultDynamicSamplerAdjustmentInterval = 15 * time.Second
+	defaultDynamicSamplerWeight             = 0.5
+	defaultDynamicSamplerMaxKeys            = 500
+	dynamicSamplerKeySeparator              = "•"
+)
+
+// DynamicSamplerConfig configures a DynamicSampler.
+type DynamicSamplerConfig struct {
+	// GoalSampleRate is the average sample rate the sampler aims for across all keys.
+	GoalSampleRate int
+	// Keys are the span attribute names whose values are combined to build the sampling key,
+	// e.g. "http.route" and "http.status_code". Only attributes present when the span
+	// starts are considered.
+	Keys []string
+	// AdjustmentInterval is how often per-key sample rates are recalculated.
+	// Defaults to 15 seconds.
+	AdjustmentInterval time.Duration
+	// Weight is the weight given to the most recent interval when updating the
+	// moving average of each key's throughput, between 0 and 1. Defaults to 0.5.
+	Weight float64
+	// MaxKeys bounds the number of distinct keys tracked per interval. Spans with keys seen
+	// after the limit is reached are sampled at GoalSampleRate. Defaults to 500.
+	MaxKeys int
+}
+
+// DynamicSampler samples spans using per-key sample rates derived from an exponential moving
+// average of each key's throughput. Rare keys are kept while frequent keys are downsampled, and
+// the chosen rate is recorded on kept spans using the SampleRate attribute, like DeterministicSampler.
+type DynamicSampler struct {
+	config DynamicSamplerConfig
+	now    func() time.Time
+
+	mu          sync.Mutex
+	lastUpdate  time.Time
+	counts      map[string]float64
+	movingAvg   map[string]float64
+	sampleRates map[string]int
+	samplers    map[int]DeterministicSampler
+}
+
+var _ trace.Sampler = (*DynamicSampler)(nil)
+
+// Returns a new DynamicSampler.
+//
+// Sample rates for each key are recalculated every AdjustmentInterval from the traffic seen
+// in previous intervals; until the first adjustment every key is sampled at GoalSampleRate.
+func NewDynamicSampler(config DynamicSamplerConfig) *DynamicSampler {
+	if config.AdjustmentInterval <= 0 {
+		config.AdjustmentInterval = defaultDynamicSamplerAdjustmentInterval
+	}
+	if config.Weight <= 0 || config.Weight > 1 {
+		config.Weight = defaultDynamicSamplerWeight
+	}
+	if config.MaxKeys <= 0 {
+		config.MaxKeys = defaultDynamicSamplerMaxKeys
+	}
+	if config.GoalSampleRate < 1 {
+		config.GoalSampleRate = 1
+	}
+	return &DynamicSampler{
+		config:      config,
+		now:         time.Now,
+		counts:      map[string]float64{},
+		movingAvg:   map[string]float64{},
+		sampleRates: map[string]int{},
+		samplers:    map[int]DeterministicSampler{config.GoalSampleRate: NewDeterministicSampler(config.GoalSampleRate)},
+	}
+}
+
+// WithDynamicSampler() sets the sampler used to sample trace spans to a DynamicSampler. Like the
+// other Honeycomb samplers, it replaces a sampler set with WithSampler() whichever option is
+// applied last.
+func WithDynamicSampler(config DynamicSamplerConfig) otelconfig.Option {
+	return withFinalSampler(NewDynamicSampler(config))
+}
+
+func (ds *DynamicSampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
+	key := ds.buildKey(parameters.Attributes)
+	return ds.samplerFor(key).ShouldSample(parameters)
+}
+
+func (ds *DynamicSampler) Description() string {
+	return "DynamicSampler"
+}
+
+func (ds *DynamicSampler) buildKey(attrs []attribute.KeyValue) string {
+	values := make([]string, len(ds.config.Keys))
+	for i, key := range ds.config.Keys {
+		for _, attr := range attrs {
+			if string(attr.Key) == key {
+				values[i] = attr.Value.Emit()
+				break
+			}
+		}
+	}
+	return strings.Join(values, dynamicSamplerKeySeparator)
+}
+
+// samplerFor counts the key towards the current interval and returns the sampler for its current
+// sample rate.
+func (ds *DynamicSampler) samplerFor(key string) DeterministicSampler {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	now := ds.now()
+	if ds.lastUpdate.IsZero() {
+		ds.lastUpdate = now
+	} else if elapsed := now.Sub(ds.lastUpdate); elapsed >= ds.config.AdjustmentInterval {
+		// decay the moving averages once per interval that has passed, so that an idle gap
+		// ages old traffic as much as the same time spent seeing no traffic for those keys
+		intervals := int(elapsed / ds.config.AdjustmentInterval)
+		for i := 0; i < intervals; i++ {
+			ds.updateSampleRates()
+			if len(ds.movingAvg) == 0 {
+				break
+			}
+		}
+		ds.lastUpdate = ds.lastUpdate.Add(time.Duration(intervals) * ds.config.AdjustmentInterval)
+	}
+
+	if _, ok := ds.counts[key]; ok || len(ds.counts) < ds.config.MaxKeys {
+		ds.counts[key]++
+	}
+
+	if rate, ok := ds.sampleRates[key]; ok {
+		return ds.samplers[rate]
+	}
+	return ds.samplers[ds.config.GoalSampleRate]
+}
+
+// updateSampleRates folds the current interval's counts into the moving average and
+// recalculates each key's sample rate. Callers must hold ds.mu.
+//
+// Each key is given a share of the overall goal throughput proportional to the log of its
+// own throughput, so that frequent keys are downsampled more aggressively than rare ones.
+// Any budget a key doesn't use is carried over to the keys that follow it.
+func (ds *DynamicSampler) updateSampleRates() {
+	weight := ds.config.Weight
+	for key, avg := range ds.movingAvg {
+		avg = avg * (1 - weight)
+		if avg < 0.5 {
+			delete(ds.movingAvg, key)
+			continue
+		}
+		ds.movingAvg[key] = avg
+	}
+	for key, count := range ds.counts {
+		ds.movingAvg[key] += count * weight
+	}
+	ds.counts = map[string]float64{}
+
+	keys := make([]string, 0, len(ds.movingAvg))
+	sumEvents := 0.0
+	logSum := 0.0
+	for key, avg := range ds.movingAvg {
+		keys = append(keys, key)
+		sumEvents += avg
+		logSum += math.Log10(math.Max(1, avg))
+	}
+	sort.Strings(keys)
+
+	rates := make(map[string]int, len(keys))
+	defer ds.setSampleRates(rates)
+	if sumEvents == 0 {
+		return
+	}
+
+	goalCount := sumEvents / float64(ds.config.GoalSampleRate)
+	if logSum == 0 {
+		// no key averages more than one span per interval, so there's no throughput
+		// difference to weight by; spread the goal evenly
+		for _, key := range keys {
+			rates[key] = ds.config.GoalSampleRate
+		}
+		return
+	}
+
+	goalRatio := goalCount / logSum
+	extra := 0.0
+	keysRemaining := len(keys)
+	for _, key := range keys {
+		count := math.Max(1, ds.movingAvg[key])
+		goalForKey := math.Max(1, math.Log10(count)*goalRatio)
+		extraForKey := extra / float64(keysRemaining)
+		goalForKey += extraForKey
+		extra -= extraForKey
+		keysRemaining--
+
+		if count <= goalForKey {
+			// this key is rarer than its share of the budget; keep all of it
+			rates[key] = 1
+			extra += goalForKey - count
+			continue
+		}
+		rate := int(math.Ceil(count / goalForKey))
+		rates[key] = rate
+		extra += goalForKey - count/float64(rate)
+	}
+}
+
+// setSampleRates replaces the per-key sample rates, keeping a sampler for each distinct rate so
+// they aren't rebuilt for every span. Callers must hold ds.mu.
+func (ds *DynamicSampler) setSampleRates(rates map[string]int) {
+	samplers := map[int]DeterministicSampler{ds.config.GoalSampleRate: ds.samplers[ds.config.GoalSampleRate]}
+	for _, rate := range rates {
+		if _, ok := samplers[rate]; !ok {
+			if sampler, ok := ds.samplers[rate]; ok {
+				samplers[rate] = sampler
+			} else {
+				samplers[rate] = NewDeterministicSampler(rate)
+			}
+		}
+	}
+	ds.sampleRates = rates
+	ds.samplers = samplers
+}
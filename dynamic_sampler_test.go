@@ -0,0 +1,109 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestDynamicSamplerUsesGoalRateBeforeFirstAdjustment(t *testing.T) {
+	sampler := NewDynamicSampler(DynamicSamplerConfig{
+		GoalSampleRate: 1,
+		Keys:           []string{"http.route"},
+	})
+	assert.Equal(t, "DynamicSampler", sampler.Description())
+
+	result := sampler.ShouldSample(trace.SamplingParameters{
+		Attributes: []attribute.KeyValue{attribute.String("http.route", "/")},
+	})
+	assert.Equal(t, trace.RecordAndSample, result.Decision)
+
+	attr := getAttributeWithKey(result.Attributes, "SampleRate")
+	if attr == nil {
+		t.Fatalf("SampleRate attribute was not found")
+	}
+	assert.Equal(t, int64(1), attr.Value.AsInt64())
+}
+
+func TestDynamicSamplerKeepsRareKeysAndDownsamplesHotKeys(t *testing.T) {
+	now := time.Now()
+	sampler := NewDynamicSampler(DynamicSamplerConfig{
+		GoalSampleRate:     10,
+		Keys:               []string{"http.route", "http.status_code"},
+		AdjustmentInterval: time.Second,
+	})
+	sampler.now = func() time.Time { return now }
+
+	hot := []attribute.KeyValue{attribute.String("http.route", "/hot"), attribute.Int("http.status_code", 200)}
+	rare := []attribute.KeyValue{attribute.String("http.route", "/rare"), attribute.Int("http.status_code", 500)}
+	for i := 0; i < 1000; i++ {
+		sampler.ShouldSample(trace.SamplingParameters{Attributes: hot})
+	}
+	for i := 0; i < 5; i++ {
+		sampler.ShouldSample(trace.SamplingParameters{Attributes: rare})
+	}
+
+	now = now.Add(time.Second)
+	result := sampler.ShouldSample(trace.SamplingParameters{Attributes: rare})
+	assert.Equal(t, trace.RecordAndSample, result.Decision)
+	attr := getAttributeWithKey(result.Attributes, "SampleRate")
+	if attr == nil {
+		t.Fatalf("SampleRate attribute was not found")
+	}
+	assert.Equal(t, int64(1), attr.Value.AsInt64())
+
+	assert.Greater(t, sampler.sampleRates["/hot•200"], 10)
+	assert.Equal(t, 1, sampler.sampleRates["/rare•500"])
+}
+
+func TestDynamicSamplerBoundsTrackedKeys(t *testing.T) {
+	sampler := NewDynamicSampler(DynamicSamplerConfig{
+		GoalSampleRate: 5,
+		Keys:           []string{"key"},
+		MaxKeys:        2,
+	})
+	for _, value := range []string{"a", "b", "c", "d"} {
+		sampler.ShouldSample(trace.SamplingParameters{
+			Attributes: []attribute.KeyValue{attribute.String("key", value)},
+		})
+	}
+	assert.Equal(t, 2, len(sampler.counts))
+}
+
+func TestDynamicSamplerDecaysOncePerElapsedInterval(t *testing.T) {
+	now := time.Now()
+	sampler := NewDynamicSampler(DynamicSamplerConfig{
+		GoalSampleRate:     10,
+		Keys:               []string{"http.route"},
+		AdjustmentInterval: time.Second,
+		Weight:             0.5,
+	})
+	sampler.now = func() time.Time { return now }
+
+	hot := []attribute.KeyValue{attribute.String("http.route", "/hot")}
+	for i := 0; i < 1000; i++ {
+		sampler.ShouldSample(trace.SamplingParameters{Attributes: hot})
+	}
+
+	now = now.Add(3*time.Second + 500*time.Millisecond)
+	sampler.ShouldSample(trace.SamplingParameters{Attributes: []attribute.KeyValue{attribute.String("http.route", "/other")}})
+	assert.Equal(t, 125.0, sampler.movingAvg["/hot"])
+	assert.Equal(t, now.Add(-500*time.Millisecond), sampler.lastUpdate)
+}
@@ -0,0 +1,108 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// errorBiasedSpanProcessor exports the spans sampled by the configured sampler as usual, and also
+// every span with an error status or exception event, whether or not it was sampled.
+//
+// Errored spans are exported with a SampleRate of 1, since all of them are kept, and other spans
+// keep the SampleRate their sampler gave them. This keeps counts weighted by SampleRate honest for
+// both errored and successful spans.
+type errorBiasedSpanProcessor struct {
+	next trace.SpanProcessor
+}
+
+var _ trace.SpanProcessor = (*errorBiasedSpanProcessor)(nil)
+
+// Returns a new error biased span processor that exports kept spans to exporter in batches.
+//
+// The processor can only keep errored spans that were recorded, so the tracer provider's sampler
+// must record the spans it doesn't sample, as one returned by NewErrorBiasedSampler() does; use
+// WithErrorBiasedSampling() to configure both. To keep whole traces that contain an error, rather
+// than just the errored spans, use WithTailSampling() with KeepErrors instead.
+func NewErrorBiasedSpanProcessor(exporter trace.SpanExporter) trace.SpanProcessor {
+	return &errorBiasedSpanProcessor{
+		next: trace.NewBatchSpanProcessor(exporter),
+	}
+}
+
+// Returns a new sampler that makes the same decisions as inner, except that spans inner drops are
+// still recorded, without being sampled, so that an error biased span processor can keep them if
+// they turn out to have errors. Spans dropped by a sampling rule that sets Drop stay dropped, even
+// if they would have had errors.
+func NewErrorBiasedSampler(inner trace.Sampler) trace.Sampler {
+	return errorBiasedSampler{inner: inner}
+}
+
+// WithErrorBiasedSampling() keeps every span with an error status or exception event, on top of
+// the spans the configured sampler samples, which keep their sample rate.
+//
+// Spans the sampler drops are recorded but not sampled, and the error biased span processor
+// exports errored ones in place of the batch span processor otelconfig uses, to the same endpoint.
+// Sampling decisions propagate to downstream services as usual: the rest of a trace the sampler
+// dropped is still dropped, so its errored spans are kept on their own. Spans matching a sampling
+// rule that sets Drop are never kept, errored or not.
+//
+// Only one of WithErrorBiasedSampling() and WithTailSampling() can be used, since both replace the
+// batch span processor; using both is reported as a configuration problem.
+func WithErrorBiasedSampling() otelconfig.Option {
+	return withSpanExport("WithErrorBiasedSampling()", NewErrorBiasedSampler, NewErrorBiasedSpanProcessor)
+}
+
+func (p *errorBiasedSpanProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *errorBiasedSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	switch {
+	case isErrorSpan(s):
+		p.next.OnEnd(withExactSampleRate(s, 1))
+	case s.SpanContext().IsSampled():
+		p.next.OnEnd(s)
+	}
+}
+
+func (p *errorBiasedSpanProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *errorBiasedSpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// errorBiasedSampler records the spans its inner sampler drops, without sampling them.
+type errorBiasedSampler struct {
+	inner trace.Sampler
+}
+
+func (s errorBiasedSampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
+	result := s.inner.ShouldSample(parameters)
+	if result.Decision == trace.Drop && !droppedByRule(result) {
+		result.Decision = trace.RecordOnly
+	}
+	return result
+}
+
+func (s errorBiasedSampler) Description() string {
+	return fmt.Sprintf("ErrorBiasedSampler{%s}", s.inner.Description())
+}
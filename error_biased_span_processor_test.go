@@ -0,0 +1,164 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestErrorBiasedSamplingAlwaysKeepsErrors(t *testing.T) {
+	exporter := NewTestExporter()
+	processor := NewErrorBiasedSpanProcessor(exporter)
+	tp := trace.NewTracerProvider(
+		// every span that is not errored is dropped
+		trace.WithSampler(NewErrorBiasedSampler(trace.NeverSample())),
+		trace.WithSpanProcessor(processor),
+	)
+	tracer := tp.Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "error status")
+	span.SetStatus(codes.Error, "boom")
+	span.End()
+	_, span = tracer.Start(context.Background(), "exception")
+	span.RecordError(errors.New("boom"))
+	span.End()
+	_, span = tracer.Start(context.Background(), "ok")
+	span.End()
+
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Equal(t, 2, len(exporter.spans))
+	assert.Equal(t, "error status", exporter.spans[0].Name())
+	assert.Equal(t, "exception", exporter.spans[1].Name())
+	for _, s := range exporter.spans {
+		assert.True(t, s.SpanContext().IsSampled())
+		attr := getAttributeWithKey(s.Attributes(), "SampleRate")
+		if attr == nil {
+			t.Fatalf("SampleRate attribute was not found")
+		}
+		assert.Equal(t, int64(1), attr.Value.AsInt64())
+	}
+}
+
+func TestErrorBiasedSamplingKeepsSampledSpans(t *testing.T) {
+	exporter := NewTestExporter()
+	processor := NewErrorBiasedSpanProcessor(exporter)
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(NewErrorBiasedSampler(NewParentBasedSampler(NewDeterministicSampler(10)))),
+		trace.WithSpanProcessor(processor),
+	)
+	tracer := tp.Tracer("test")
+
+	// find a trace the deterministic sampler keeps
+	var ctx context.Context
+	var root oteltrace.Span
+	for {
+		ctx, root = tracer.Start(context.Background(), "root")
+		if root.SpanContext().IsSampled() {
+			break
+		}
+		root.End()
+	}
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	exporter.spans = nil
+
+	// its spans propagate as sampled and keep their sample rate, unless they have errors
+	_, child := tracer.Start(ctx, "child")
+	assert.True(t, child.SpanContext().IsSampled())
+	child.End()
+	_, errored := tracer.Start(ctx, "errored")
+	errored.SetStatus(codes.Error, "boom")
+	errored.End()
+	root.End()
+
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	rates := map[string]int64{}
+	for _, s := range exporter.spans {
+		rates[s.Name()] = getAttributeWithKey(s.Attributes(), "SampleRate").Value.AsInt64()
+	}
+	assert.Equal(t, map[string]int64{"child": 10, "errored": 1, "root": 10}, rates)
+}
+
+func TestConfigureErrorBiasedSampling(t *testing.T) {
+	t.Setenv("SAMPLE_RATE", "10")
+	t.Setenv("HONEYCOMB_SAMPLER_ERROR_BIASED", "true")
+	t.Setenv("HONEYCOMB_SAMPLER_PARENT_BASED", "true")
+	config := freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	state := takeConfigState(config)
+	state.applySamplers(config)
+	// error bias is applied on top of the configured sampler, whatever order options are in
+	assert.Equal(t, "ErrorBiasedSampler{ParentBasedSampler{DeterministicSampler}}", config.Sampler.Description())
+	require.NotNil(t, state.exportSpans)
+	require.NoError(t, state.exportSpans(NewTestExporter()).Shutdown(context.Background()))
+
+	config = freshConfig()
+	WithErrorBiasedSampling()(config)
+	WithParentBasedSampling()(config)
+	takeConfigState(config).applySamplers(config)
+	assert.Equal(t, "ErrorBiasedSampler{ParentBasedSampler{AlwaysOnSampler}}", config.Sampler.Description())
+}
+
+func TestErrorBiasedSamplingRespectsDropRules(t *testing.T) {
+	rules, err := NewRulesBasedSampler([]SamplingRule{
+		{Name: "health checks", Drop: true, SpanName: "GET /healthz"},
+		{Name: "rarely", SampleRate: 1000000, SpanName: "GET /rarely"},
+	}, 1)
+	require.NoError(t, err)
+	exporter := NewTestExporter()
+	processor := NewErrorBiasedSpanProcessor(exporter)
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(NewErrorBiasedSampler(rules)),
+		trace.WithSpanProcessor(processor),
+	)
+	tracer := tp.Tracer("test")
+
+	// errored spans matching a drop rule are dropped, but those sampled out by a rule are kept
+	for _, name := range []string{"GET /healthz", "GET /rarely"} {
+		_, span := tracer.Start(context.Background(), name)
+		span.SetStatus(codes.Error, "boom")
+		span.End()
+	}
+
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Equal(t, 1, len(exporter.spans))
+	assert.Equal(t, "GET /rarely", exporter.spans[0].Name())
+}
+
+func TestErrorBiasedAndTailSamplingConflict(t *testing.T) {
+	config := freshConfig()
+	WithTailSampling(TailSamplingConfig{SampleRate: 1})(config)
+	WithErrorBiasedSampling()(config)
+	state := takeConfigState(config)
+	require.Equal(t, 1, len(state.problems))
+	assert.Equal(t, conflictingSpanExportMessage, state.problems[0].format)
+	assert.Equal(t, []interface{}{"WithErrorBiasedSampling()", "WithTailSampling()"}, state.problems[0].args)
+	assert.True(t, state.problems[0].warn)
+
+	// the same option applied twice is no conflict
+	config = freshConfig()
+	WithErrorBiasedSampling()(config)
+	WithErrorBiasedSampling()(config)
+	assert.Empty(t, takeConfigState(config).problems)
+}
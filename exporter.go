@@ -0,0 +1,223 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+)
+
+// The exporters and endpoint resolution here mirror what otelconfig and its pipelines package do,
+// which aren't exported, for the pipelines set up by setupPipelines.
+
+// newTraceExporter returns an OTLP span exporter. If apiKey is not nil, each export uses the API
+// key it returns, when not empty, in place of the one in headers, so that the key can change
+// without setting up the pipeline again.
+func newTraceExporter(protocol otelconfig.Protocol, endpoint string, insecure bool, headers map[string]string, apiKey func() string) (trace.SpanExporter, error) {
+	switch protocol {
+	case otelconfig.ProtocolGRPC:
+		secureOption := otlptracegrpc.WithTLSCredentials(credentials.NewClientTLSFromCert(nil, ""))
+		if insecure {
+			secureOption = otlptracegrpc.WithInsecure()
+		}
+		options := []otlptracegrpc.Option{
+			secureOption,
+			otlptracegrpc.WithEndpoint(endpoint),
+			otlptracegrpc.WithHeaders(headers),
+			otlptracegrpc.WithCompressor(gzip.Name),
+		}
+		if apiKey != nil {
+			options = append(options, otlptracegrpc.WithDialOption(grpc.WithUnaryInterceptor(apiKeyInterceptor(apiKey))))
+		}
+		return otlptrace.New(context.Background(), otlptracegrpc.NewClient(options...))
+	case otelconfig.ProtocolHTTPProto:
+		create := func(headers map[string]string) (trace.SpanExporter, error) {
+			secureOption := otlptracehttp.WithTLSClientConfig(&tls.Config{})
+			if insecure {
+				secureOption = otlptracehttp.WithInsecure()
+			}
+			return otlptrace.New(context.Background(), otlptracehttp.NewClient(
+				secureOption,
+				otlptracehttp.WithEndpoint(endpoint),
+				otlptracehttp.WithHeaders(headers),
+				otlptracehttp.WithCompression(otlptracehttp.GzipCompression),
+			))
+		}
+		if apiKey == nil {
+			return create(headers)
+		}
+		return newKeyedSpanExporter(headers, apiKey, create)
+	default:
+		return nil, fmt.Errorf("'%s' is not a supported protocol", protocol)
+	}
+}
+
+// newMetricExporter returns an OTLP metric exporter, using the API key returned by apiKey, if not
+// nil, like newTraceExporter.
+func newMetricExporter(protocol otelconfig.Protocol, endpoint string, insecure bool, headers map[string]string, apiKey func() string) (metric.Exporter, error) {
+	switch protocol {
+	case otelconfig.ProtocolGRPC:
+		secureOption := otlpmetricgrpc.WithTLSCredentials(credentials.NewClientTLSFromCert(nil, ""))
+		if insecure {
+			secureOption = otlpmetricgrpc.WithInsecure()
+		}
+		options := []otlpmetricgrpc.Option{
+			secureOption,
+			otlpmetricgrpc.WithEndpoint(endpoint),
+			otlpmetricgrpc.WithHeaders(headers),
+			otlpmetricgrpc.WithCompressor(gzip.Name),
+		}
+		if apiKey != nil {
+			options = append(options, otlpmetricgrpc.WithDialOption(grpc.WithUnaryInterceptor(apiKeyInterceptor(apiKey))))
+		}
+		return otlpmetricgrpc.New(context.Background(), options...)
+	case otelconfig.ProtocolHTTPProto:
+		create := func(headers map[string]string) (metric.Exporter, error) {
+			secureOption := otlpmetrichttp.WithTLSClientConfig(&tls.Config{})
+			if insecure {
+				secureOption = otlpmetrichttp.WithInsecure()
+			}
+			return otlpmetrichttp.New(context.Background(),
+				secureOption,
+				otlpmetrichttp.WithEndpoint(endpoint),
+				otlpmetrichttp.WithHeaders(headers),
+				otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression),
+			)
+		}
+		if apiKey == nil {
+			return create(headers)
+		}
+		return newKeyedMetricExporter(headers, apiKey, create)
+	default:
+		return nil, fmt.Errorf("'%s' is not a supported protocol", protocol)
+	}
+}
+
+// apiKeyInterceptor sets the API key header of each gRPC export to the key returned by apiKey.
+func apiKeyInterceptor(apiKey func() string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if key := apiKey(); key != "" {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			md = md.Copy()
+			md.Set(honeycombApiKeyHeader, key)
+			ctx = metadata.NewOutgoingContext(ctx, md)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// tracesEndpoint resolves the traces endpoint, insecure flag and protocol the same way otelconfig does.
+func tracesEndpoint(c *otelconfig.Config) (string, bool, otelconfig.Protocol) {
+	return signalEndpoint(c, c.TracesExporterEndpoint, c.TracesExporterEndpointInsecure, c.TracesExporterProtocol)
+}
+
+// metricsEndpoint resolves the metrics endpoint, insecure flag and protocol the same way otelconfig does.
+func metricsEndpoint(c *otelconfig.Config) (string, bool, otelconfig.Protocol) {
+	return signalEndpoint(c, c.MetricsExporterEndpoint, c.MetricsExporterEndpointInsecure, c.MetricsExporterProtocol)
+}
+
+// signalEndpoint resolves a signal's endpoint, falling back to the generic endpoint and protocol.
+func signalEndpoint(c *otelconfig.Config, endpoint string, insecure bool, protocol otelconfig.Protocol) (string, bool, otelconfig.Protocol) {
+	if endpoint == "" {
+		endpoint, insecure = c.ExporterEndpoint, c.ExporterEndpointInsecure
+	}
+	if protocol == "" {
+		protocol = c.ExporterProtocol
+	}
+	if protocol == "" {
+		protocol = otelconfig.ProtocolGRPC
+	}
+	if endpoint == "" {
+		return "", false, protocol
+	}
+
+	port := otelconfig.GRPCDefaultPort
+	if protocol != otelconfig.ProtocolGRPC {
+		port = otelconfig.HTTPDefaultPort
+	}
+	return ensurePort(trimHttpScheme(endpoint, protocol), port), insecure, protocol
+}
+
+// tracesHeaders combines the generic and traces specific headers.
+func tracesHeaders(c *otelconfig.Config) map[string]string {
+	return mergeHeaders(c.Headers, c.TracesHeaders)
+}
+
+// metricsHeaders combines the generic and metrics specific headers.
+func metricsHeaders(c *otelconfig.Config) map[string]string {
+	return mergeHeaders(c.Headers, c.MetricsHeaders)
+}
+
+func mergeHeaders(generic map[string]string, signal map[string]string) map[string]string {
+	headers := map[string]string{}
+	for key, value := range generic {
+		headers[key] = value
+	}
+	for key, value := range signal {
+		headers[key] = value
+	}
+	return headers
+}
+
+// ensurePort adds defaultPort to host if it doesn't already have a port.
+func ensurePort(host string, defaultPort string) string {
+	ix := strings.Index(host, ":")
+	switch {
+	case ix < 0:
+		return host + ":" + defaultPort
+	case ix == len(host)-1:
+		return host + defaultPort
+	default:
+		return host
+	}
+}
+
+// trimHttpScheme removes the scheme from url, defaulting to port 443 for https gRPC endpoints.
+func trimHttpScheme(endpoint string, protocol otelconfig.Protocol) string {
+	switch {
+	case strings.HasPrefix(endpoint, "https://"):
+		if protocol == otelconfig.ProtocolGRPC {
+			if u, err := url.Parse(endpoint); err == nil {
+				port := u.Port()
+				if port == "" {
+					port = otelconfig.SSLDefaultPort
+				}
+				return net.JoinHostPort(u.Hostname(), port)
+			}
+		}
+		return strings.TrimPrefix(endpoint, "https://")
+	case strings.HasPrefix(endpoint, "http://"):
+		return strings.TrimPrefix(endpoint, "http://")
+	default:
+		return endpoint
+	}
+}
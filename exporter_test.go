@@ -0,0 +1,128 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTracesEndpointResolution(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		configure        func(c *otelconfig.Config)
+		expectedEndpoint string
+		expectedInsecure bool
+		expectedProtocol otelconfig.Protocol
+	}{
+		{
+			desc: "default honeycomb endpoint",
+			configure: func(c *otelconfig.Config) {
+				c.ExporterEndpoint = defaultExporterEndpoint
+			},
+			expectedEndpoint: "api.honeycomb.io:443",
+			expectedProtocol: otelconfig.ProtocolGRPC,
+		},
+		{
+			desc: "https grpc endpoint without port",
+			configure: func(c *otelconfig.Config) {
+				c.ExporterEndpoint = "https://api.eu1.honeycomb.io"
+			},
+			expectedEndpoint: "api.eu1.honeycomb.io:443",
+			expectedProtocol: otelconfig.ProtocolGRPC,
+		},
+		{
+			desc: "traces specific http endpoint",
+			configure: func(c *otelconfig.Config) {
+				c.ExporterEndpoint = "generic:4317"
+				c.TracesExporterEndpoint = "http://localhost"
+				c.TracesExporterEndpointInsecure = true
+				c.TracesExporterProtocol = otelconfig.ProtocolHTTPProto
+			},
+			expectedEndpoint: "localhost:4318",
+			expectedInsecure: true,
+			expectedProtocol: otelconfig.ProtocolHTTPProto,
+		},
+		{
+			desc:             "no endpoint",
+			configure:        func(c *otelconfig.Config) {},
+			expectedEndpoint: "",
+			expectedProtocol: otelconfig.ProtocolGRPC,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			config := freshConfig()
+			tC.configure(config)
+			endpoint, insecure, protocol := tracesEndpoint(config)
+			assert.Equal(t, tC.expectedEndpoint, endpoint)
+			assert.Equal(t, tC.expectedInsecure, insecure)
+			assert.Equal(t, tC.expectedProtocol, protocol)
+		})
+	}
+}
+
+func TestTracesHeadersPreferTracesSpecificValues(t *testing.T) {
+	config := freshConfig()
+	config.Headers[honeycombApiKeyHeader] = "generic"
+	config.Headers[otlpProtoVersionHeader] = otlpProtoVersionValue
+	config.TracesHeaders[honeycombApiKeyHeader] = "traces"
+
+	assert.Equal(t, map[string]string{
+		honeycombApiKeyHeader:  "traces",
+		otlpProtoVersionHeader: otlpProtoVersionValue,
+	}, tracesHeaders(config))
+}
+
+func TestExportersSendCurrentApiKey(t *testing.T) {
+	key := "first-key"
+	apiKey := func() string { return key }
+
+	// HTTP exporters are created again with the new key when it changes
+	var created []map[string]string
+	create := func(headers map[string]string) (trace.SpanExporter, error) {
+		created = append(created, headers)
+		return NewTestExporter(), nil
+	}
+	configured := map[string]string{honeycombApiKeyHeader: "configured-key", "other": "header"}
+	exporter, err := newKeyedSpanExporter(configured, apiKey, create)
+	require.NoError(t, err)
+	require.NoError(t, exporter.ExportSpans(context.Background(), nil))
+	require.Equal(t, 1, len(created))
+	assert.Equal(t, map[string]string{honeycombApiKeyHeader: "first-key", "other": "header"}, created[0])
+
+	key = "second-key"
+	require.NoError(t, exporter.ExportSpans(context.Background(), nil))
+	require.Equal(t, 2, len(created))
+	assert.Equal(t, "second-key", created[1][honeycombApiKeyHeader])
+	assert.Equal(t, "configured-key", configured[honeycombApiKeyHeader])
+
+	// gRPC exports set the key on each call
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(honeycombApiKeyHeader, "configured-key"))
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	require.NoError(t, apiKeyInterceptor(apiKey)(ctx, "export", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"second-key"}, sent.Get(honeycombApiKeyHeader))
+}
@@ -19,6 +19,8 @@ import (
 	"regexp"
 	"runtime"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/honeycombio/otel-config-go/otelconfig"
 
@@ -104,6 +106,39 @@ func WithSampler(sampleRate int) otelconfig.Option {
 	}
 }
 
+// withRulesBasedSamplerFile() sets the sampler to a RulesBasedSampler loaded from path, in place of
+// any sampler set by other options. If the file cannot be loaded it is reported as a
+// configuration problem and spans are sampled at defaultSampleRate instead. When reloadInterval is positive the file is watched for changes,
+// which are applied without restarting, from when OpenTelemetry is configured until it is shut down.
+func withRulesBasedSamplerFile(path string, defaultSampleRate int, reloadInterval time.Duration) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		load := func(path string) (trace.Sampler, error) {
+			return NewRulesBasedSamplerFromFile(path, defaultSampleRate)
+		}
+
+		sampler, err := load(path)
+		if err != nil {
+			withConfigProblem(samplerRulesFileInvalidMessage, path, err)(c)
+			sampler = NewDeterministicSampler(defaultSampleRate)
+		}
+		if reloadInterval <= 0 {
+			withFinalSampler(sampler)(c)
+			return
+		}
+
+		reloadable := NewReloadableSampler(sampler)
+		withFinalSampler(reloadable)(c)
+		withSetup(func(c *otelconfig.Config) (func(), error) {
+			logError := func(err error) {
+				if c.Logger != nil {
+					c.Logger.Debugf("%s\n%v", samplerRulesFileErrorMessage, err)
+				}
+			}
+			return reloadable.WatchFile(path, reloadInterval, load, logError), nil
+		})(c)
+	}
+}
+
 // WithDebugSpanExporter() determines whether a debug (stdout) traces exporter should be configured.
 func WithDebugSpanExporter() otelconfig.Option {
 	spanExporter, _ := stdouttrace.New(stdouttrace.WithPrettyPrint())
@@ -115,46 +150,144 @@ func getVendorOptionSetters() []otelconfig.Option {
 		WithHoneycomb(),
 	}
 
-	apikey := ""
-	serviceName := "unknown_service:go"
+	// settings from HONEYCOMB_CONFIG_FILE apply unless overridden by environment variables
+	settings, err := loadConfigSettings()
+	if err != nil {
+		opts = append(opts, withConfigWarning(configFileInvalidMessage, "HONEYCOMB_CONFIG_FILE", err))
+	}
+	// as do settings from OTEL_EXPERIMENTAL_CONFIG_FILE, unless also set in HONEYCOMB_CONFIG_FILE
+	declarativeOpts, declarativeSettings, err := loadDeclarativeConfig()
+	if err != nil {
+		opts = append(opts, withConfigWarning(configFileInvalidMessage, "OTEL_EXPERIMENTAL_CONFIG_FILE", err))
+	}
+	opts = append(opts, declarativeOpts...)
+	for name, value := range declarativeSettings {
+		if _, ok := settings[name]; !ok {
+			settings[name] = value
+		}
+	}
+
+	if strictStr := settings.get("HONEYCOMB_STRICT_CONFIG"); strictStr != "" {
+		strict, _ := strconv.ParseBool(strictStr)
+		if strict {
+			opts = append(opts, WithStrictValidation())
+		}
+	}
+	if validateKeyStr := settings.get("HONEYCOMB_VALIDATE_API_KEY"); validateKeyStr != "" {
+		enabled, _ := strconv.ParseBool(validateKeyStr)
+		if enabled {
+			opts = append(opts, WithKeyValidation())
+		}
+	}
 
-	if endpoint := os.Getenv("HONEYCOMB_API_ENDPOINT"); endpoint != "" {
+	if endpoint := settings.get("HONEYCOMB_API_ENDPOINT"); endpoint != "" {
 		opts = append(opts, otelconfig.WithExporterEndpoint(endpoint))
 	}
-	if endpoint := os.Getenv("HONEYCOMB_TRACES_API_ENDPOINT"); endpoint != "" {
+	if endpoint := settings.get("HONEYCOMB_TRACES_API_ENDPOINT"); endpoint != "" {
 		opts = append(opts, otelconfig.WithTracesExporterEndpoint(endpoint))
 	}
-	if endpoint := os.Getenv("HONEYCOMB_METRICS_API_ENDPOINT"); endpoint != "" {
+	if endpoint := settings.get("HONEYCOMB_METRICS_API_ENDPOINT"); endpoint != "" {
 		opts = append(opts, otelconfig.WithMetricsExporterEndpoint(endpoint))
 	}
-	if apikey = os.Getenv("HONEYCOMB_API_KEY"); apikey != "" {
+	if apikey := settings.get("HONEYCOMB_API_KEY"); apikey != "" {
 		opts = append(opts, WithApiKey(apikey))
 	}
 
-	if apikey := os.Getenv("HONEYCOMB_TRACES_APIKEY"); apikey != "" {
+	if apikey := settings.get("HONEYCOMB_TRACES_APIKEY"); apikey != "" {
 		opts = append(opts, WithTracesApiKey(apikey))
 	}
-	if apikey := os.Getenv("HONEYCOMB_METRICS_APIKEY"); apikey != "" {
+	if apikey := settings.get("HONEYCOMB_METRICS_APIKEY"); apikey != "" {
 		opts = append(opts, WithMetricsApiKey(apikey))
 	}
-	if dataset := os.Getenv("HONEYCOMB_DATASET"); dataset != "" {
+	// the command is run directly rather than by a shell, so it's only split on whitespace and
+	// commands that would need quoting or escaping are rejected rather than run differently
+	if command := settings.get("HONEYCOMB_API_KEY_COMMAND"); command != "" {
+		if fields := strings.Fields(command); len(fields) > 0 && !strings.ContainsAny(command, `"'\`) {
+			opts = append(opts, WithApiKeyProvider(ApiKeyFromCommand(fields[0], fields[1:]...)))
+		} else {
+			opts = append(opts, withConfigProblem(invalidSettingMessage, "HONEYCOMB_API_KEY_COMMAND", command, "a command and arguments without quotes or backslashes"))
+		}
+	}
+	if path := settings.get("HONEYCOMB_API_KEY_FILE"); path != "" {
+		opts = append(opts, WithApiKeyFile(path))
+	}
+	if path := settings.get("HONEYCOMB_TRACES_APIKEY_FILE"); path != "" {
+		opts = append(opts, WithTracesApiKeyFile(path))
+	}
+	if path := settings.get("HONEYCOMB_METRICS_APIKEY_FILE"); path != "" {
+		opts = append(opts, WithMetricsApiKeyFile(path))
+	}
+	if refreshOnSighupStr := settings.get("HONEYCOMB_API_KEY_REFRESH_ON_SIGHUP"); refreshOnSighupStr != "" {
+		enabled, _ := strconv.ParseBool(refreshOnSighupStr)
+		if enabled {
+			opts = append(opts, WithApiKeyRefreshOnSignal())
+		}
+	}
+	if intervalStr := settings.get("HONEYCOMB_API_KEY_REFRESH_INTERVAL"); intervalStr != "" {
+		interval, err := time.ParseDuration(intervalStr)
+		if err == nil {
+			opts = append(opts, WithApiKeyRefreshInterval(interval))
+		} else {
+			opts = append(opts, withConfigProblem(invalidSettingMessage, "HONEYCOMB_API_KEY_REFRESH_INTERVAL", intervalStr, "a duration such as 1m"))
+		}
+	}
+	if dataset := settings.get("HONEYCOMB_DATASET"); dataset != "" {
 		opts = append(opts, WithDataset(dataset))
 	}
 
-	if dataset := os.Getenv("HONEYCOMB_TRACES_DATASET"); dataset != "" {
+	if dataset := settings.get("HONEYCOMB_TRACES_DATASET"); dataset != "" {
 		opts = append(opts, WithTracesDataset(dataset))
 	}
-	if dataset := os.Getenv("HONEYCOMB_METRICS_DATASET"); dataset != "" {
+	if dataset := settings.get("HONEYCOMB_METRICS_DATASET"); dataset != "" {
 		opts = append(opts, WithMetricsDataset(dataset))
 	}
-	if sampleRateStr := os.Getenv("SAMPLE_RATE"); sampleRateStr != "" {
-		sampleRate, err := strconv.Atoi(sampleRateStr)
+	sampleRate := 1
+	if sampleRateStr := settings.get("SAMPLE_RATE"); sampleRateStr != "" {
+		rate, err := strconv.Atoi(sampleRateStr)
 		if err == nil {
+			sampleRate = rate
 			opts = append(opts, WithSampler(sampleRate))
+		} else {
+			opts = append(opts, withConfigProblem(invalidSettingMessage, "SAMPLE_RATE", sampleRateStr, "a whole number"))
+		}
+	}
+	if epsStr := settings.get("HONEYCOMB_SAMPLER_TARGET_EPS"); epsStr != "" {
+		eps, err := strconv.ParseFloat(epsStr, 64)
+		if err == nil && eps > 0 {
+			opts = append(opts, WithThroughputSampler(eps))
+			if sampleRateStr := settings.get("SAMPLE_RATE"); sampleRateStr != "" {
+				opts = append(opts, withConfigProblem(conflictingSampleRatesMessage, sampleRateStr))
+			}
+		} else {
+			opts = append(opts, withConfigProblem(invalidSettingMessage, "HONEYCOMB_SAMPLER_TARGET_EPS", epsStr, "a number above 0"))
+		}
+	}
+	if rulesFile := settings.get("HONEYCOMB_SAMPLER_RULES_FILE"); rulesFile != "" {
+		reloadInterval := defaultSamplerReloadInterval
+		if intervalStr := settings.get("HONEYCOMB_SAMPLER_RELOAD_INTERVAL"); intervalStr != "" {
+			interval, err := time.ParseDuration(intervalStr)
+			if err == nil {
+				reloadInterval = interval
+			} else {
+				opts = append(opts, withConfigProblem(invalidSettingMessage, "HONEYCOMB_SAMPLER_RELOAD_INTERVAL", intervalStr, "a duration such as 30s"))
+			}
+		}
+		opts = append(opts, withRulesBasedSamplerFile(rulesFile, sampleRate, reloadInterval))
+	}
+	if parentBasedStr := settings.get("HONEYCOMB_SAMPLER_PARENT_BASED"); parentBasedStr != "" {
+		enabled, _ := strconv.ParseBool(parentBasedStr)
+		if enabled {
+			opts = append(opts, WithParentBasedSampling())
+		}
+	}
+	if errorBiasedStr := settings.get("HONEYCOMB_SAMPLER_ERROR_BIASED"); errorBiasedStr != "" {
+		enabled, _ := strconv.ParseBool(errorBiasedStr)
+		if enabled {
+			opts = append(opts, WithErrorBiasedSampling())
 		}
 	}
 
-	if enabledStr := os.Getenv("DEBUG"); enabledStr != "" {
+	if enabledStr := settings.get("DEBUG"); enabledStr != "" {
 		enabled, _ := strconv.ParseBool(enabledStr)
 		if enabled {
 			opts = append(opts, WithDebugSpanExporter())
@@ -162,29 +295,63 @@ func getVendorOptionSetters() []otelconfig.Option {
 		}
 	}
 
-	if serviceName = os.Getenv("OTEL_SERVICE_NAME"); serviceName == "" {
+	if serviceName := settings.get("OTEL_SERVICE_NAME"); serviceName == "" {
 		opts = append(opts, otelconfig.WithServiceName("unknown_service:go"))
+	} else if os.Getenv("OTEL_SERVICE_NAME") == "" {
+		// the name is from a config file, as otelconfig reads OTEL_SERVICE_NAME itself
+		opts = append(opts, otelconfig.WithServiceName(serviceName))
+	}
+	if protocol := settings.get("OTEL_EXPORTER_OTLP_PROTOCOL"); protocol != "" {
+		opts = append(opts, otelconfig.WithExporterProtocol(otelconfig.Protocol(protocol)))
+	}
+	if insecureStr := settings.get("OTEL_EXPORTER_OTLP_INSECURE"); insecureStr != "" {
+		insecure, _ := strconv.ParseBool(insecureStr)
+		opts = append(opts, otelconfig.WithExporterInsecure(insecure))
 	}
 
-	if enableLocalVisualizationsStr := os.Getenv("HONEYCOMB_ENABLE_LOCAL_VISUALIZATIONS"); enableLocalVisualizationsStr != "" {
+	if enableLocalVisualizationsStr := settings.get("HONEYCOMB_ENABLE_LOCAL_VISUALIZATIONS"); enableLocalVisualizationsStr != "" {
 		enabled, _ := strconv.ParseBool(enableLocalVisualizationsStr)
 		if enabled {
-			exporter, _ := NewSpanLinkExporter(apikey, serviceName)
-			sp := otelconfig.WithSpanProcessor(trace.NewSimpleSpanProcessor(exporter))
-			opts = append(opts, sp)
+			opts = append(opts, withLocalVisualizations(settings))
 		}
 	}
 
+	if enableTraceSummaryStr := settings.get("HONEYCOMB_ENABLE_LOCAL_TRACE_SUMMARY"); enableTraceSummaryStr != "" {
+		enabled, _ := strconv.ParseBool(enableTraceSummaryStr)
+		if enabled {
+			opts = append(opts, WithLocalTraceSummary(nil))
+		}
+	}
+
+	if addr := settings.get("HONEYCOMB_LOCAL_UI_ADDR"); addr != "" {
+		var maxTraces int
+		if maxTracesStr := settings.get("HONEYCOMB_LOCAL_UI_MAX_TRACES"); maxTracesStr != "" {
+			var err error
+			if maxTraces, err = strconv.Atoi(maxTracesStr); err != nil {
+				opts = append(opts, withConfigProblem(invalidSettingMessage, "HONEYCOMB_LOCAL_UI_MAX_TRACES", maxTracesStr, "a whole number"))
+			}
+		}
+		opts = append(opts, WithLocalUI(addr, maxTraces))
+	}
+
+	if enabledStr := settings.get("OTEL_TRACES_ENABLED"); enabledStr != "" {
+		enabled, _ := strconv.ParseBool(enabledStr)
+		opts = append(opts, withTracesEnabled(enabled))
+	}
+
 	// default metrics off unless explicity enabled
 	metricsEnabled := false
-	if enabledStr := os.Getenv("OTEL_METRICS_ENABLED"); enabledStr != "" {
+	if enabledStr := settings.get("OTEL_METRICS_ENABLED"); enabledStr != "" {
 		enabled, _ := strconv.ParseBool(enabledStr)
 		if enabled {
 			metricsEnabled = true
 		}
-	} else {
+	}
+	if os.Getenv("OTEL_METRICS_ENABLED") == "" && !metricsEnabled {
 		// if the variable is not set, set it to avoid enabling metrics
-		// via the library by default
+		// via the library by default. otelconfig enables metrics when it isn't set, whatever
+		// options set, and unlike traces they have to be off by the time its ValidateConfig hook
+		// runs, so this is the one setting still passed on through the environment.
 		os.Setenv("OTEL_METRICS_ENABLED", "false")
 	}
 	opts = append(opts, otelconfig.WithMetricsEnabled(metricsEnabled))
@@ -192,24 +359,31 @@ func getVendorOptionSetters() []otelconfig.Option {
 }
 
 func validateConfig(c *otelconfig.Config) error {
-	apikey := c.Headers[honeycombApiKeyHeader]
-	dataset := c.Headers[honeycombDatasetHeader]
-
-	if c.Logger != nil {
-		if len(apikey) == 0 {
-			c.Logger.Debugf(noApiKeyDetectedMessage)
-		} else if isClassicKey(apikey) {
-			if dataset == "" {
-				c.Logger.Debugf("%s\n%s", classicKeyMissingDatasetMessage, apikey)
-			}
-		} else {
-			if dataset != "" {
-				c.Logger.Debugf(dontSetADatasetMessageMessage)
-			}
-		}
+	state := takeConfigState(c)
+	if state.tracesEnabled != nil {
+		c.TracesEnabled = *state.tracesEnabled
+	}
+	state.applySamplers(c)
+
+	// keys from providers are loaded first so they're validated like any other key
+	keys := state.apiKeys
+	if keys != nil {
+		state.problems = append(state.problems, loadApiKeys(c, keys)...)
 	}
+	if err := reportConfigProblems(c, state); err != nil {
+		return err
+	}
+
+	// trace link helpers use the most recently configured API key, dataset and endpoint
+	defaultTraceLinks.Store(newConfigTraceLinkResolver(c, state))
 
-	return nil
+	if keys != nil {
+		state.setups = append(state.setups, watchApiKeys(keys))
+	}
+	if keys != nil || state.exportSpans != nil {
+		state.setups = append(state.setups, setupPipelines(keys, state.exportSpans))
+	}
+	return state.runSetups(c)
 }
 
 func isClassicKey(key string) bool {
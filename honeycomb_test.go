@@ -256,6 +256,17 @@ func TestSettingExportersAddsLocalVizExporter(t *testing.T) {
 	assert.Equal(t, 1, len(config.SpanProcessors))
 }
 
+func TestSettingExportersAddsTraceSummaryExporter(t *testing.T) {
+	config := freshConfig()
+	t.Setenv("HONEYCOMB_ENABLE_LOCAL_TRACE_SUMMARY", "true")
+
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+
+	assert.Equal(t, 1, len(config.SpanProcessors))
+}
+
 func TestServiceNameDefaultsToUnknownServiceWhenNotSet(t *testing.T) {
 	config := freshConfig()
 
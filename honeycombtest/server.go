@@ -0,0 +1,384 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package honeycombtest provides an in-process fake of Honeycomb's OTLP ingest API, so that
+// instrumentation can be tested end-to-end without a collector or a real Honeycomb team.
+package honeycombtest
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	collectormetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // accept gzip compressed gRPC exports
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	apiKeyHeader  = "x-honeycomb-team"
+	datasetHeader = "x-honeycomb-dataset"
+
+	defaultWaitTimeout = 5 * time.Second
+)
+
+var (
+	errMissingApiKey = errors.New("missing API key")
+	errUnknownApiKey = errors.New("unknown API key")
+	errWrongDataset  = errors.New("unexpected dataset")
+)
+
+// Server receives OTLP traces and metrics over both HTTP and gRPC, validating the Honeycomb
+// headers of each export and storing whatever it accepts.
+type Server struct {
+	apiKey      string
+	dataset     string
+	waitTimeout time.Duration
+
+	httpServer   *httptest.Server
+	grpcServer   *grpc.Server
+	grpcListener net.Listener
+
+	mu sync.Mutex
+	// previousApiKey is still accepted until previousApiKeyExpiry, after the key is rotated.
+	previousApiKey       string
+	previousApiKeyExpiry time.Time
+	spans                []Span
+	metrics              []Metric
+	requests             []Request
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithApiKey() sets the API key the server expects in the x-honeycomb-team header. Exports
+// without it, or with a different key, are rejected. By default any key, or none, is accepted.
+func WithApiKey(apikey string) Option {
+	return func(s *Server) {
+		s.apiKey = apikey
+	}
+}
+
+// WithDataset() sets the dataset the server expects in the x-honeycomb-dataset header. Exports
+// naming a different dataset, or none, are rejected. By default any dataset, or none, is accepted.
+func WithDataset(dataset string) Option {
+	return func(s *Server) {
+		s.dataset = dataset
+	}
+}
+
+// WithWaitTimeout() sets how long assertion helpers such as RequireSpan() wait for telemetry to
+// arrive before failing the test. The default is 5 seconds.
+func WithWaitTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.waitTimeout = timeout
+	}
+}
+
+// Request describes an export received by the server.
+type Request struct {
+	// Protocol is either "http" or "grpc".
+	Protocol string
+	// Signal is either "traces" or "metrics".
+	Signal string
+	// Headers holds the request headers or gRPC metadata, keyed by lowercase name.
+	Headers map[string]string
+	// Err is the reason the export was rejected, or nil if it was accepted.
+	Err error
+}
+
+// NewServer() starts a fake Honeycomb ingest server listening on random local ports for OTLP over
+// HTTP and gRPC. The server is closed when the test and its subtests complete.
+func NewServer(t testing.TB, options ...Option) *Server {
+	t.Helper()
+	s := &Server{waitTimeout: defaultWaitTimeout}
+	for _, option := range options {
+		option(s)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("honeycombtest: unable to listen for gRPC: %v", err)
+	}
+	s.grpcListener = listener
+	s.grpcServer = grpc.NewServer()
+	collectortracepb.RegisterTraceServiceServer(s.grpcServer, traceService{server: s})
+	collectormetricspb.RegisterMetricsServiceServer(s.grpcServer, metricsService{server: s})
+	go func() {
+		_ = s.grpcServer.Serve(listener)
+	}()
+
+	s.httpServer = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.httpServer.Close()
+	s.grpcServer.Stop()
+}
+
+// HTTPEndpoint() returns the host and port accepting OTLP over HTTP.
+func (s *Server) HTTPEndpoint() string {
+	return strings.TrimPrefix(s.httpServer.URL, "http://")
+}
+
+// GRPCEndpoint() returns the host and port accepting OTLP over gRPC.
+func (s *Server) GRPCEndpoint() string {
+	return s.grpcListener.Addr().String()
+}
+
+// HTTPOptions() returns the options sending traces and metrics to the server using OTLP over HTTP.
+func (s *Server) HTTPOptions() []otelconfig.Option {
+	return []otelconfig.Option{
+		otelconfig.WithExporterEndpoint(s.HTTPEndpoint()),
+		otelconfig.WithExporterInsecure(true),
+		otelconfig.WithExporterProtocol(otelconfig.ProtocolHTTPProto),
+	}
+}
+
+// GRPCOptions() returns the options sending traces and metrics to the server using OTLP over gRPC.
+func (s *Server) GRPCOptions() []otelconfig.Option {
+	return []otelconfig.Option{
+		otelconfig.WithExporterEndpoint(s.GRPCEndpoint()),
+		otelconfig.WithExporterInsecure(true),
+		otelconfig.WithExporterProtocol(otelconfig.ProtocolGRPC),
+	}
+}
+
+// Spans() returns the spans received so far, in the order they arrived.
+func (s *Server) Spans() []Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Span(nil), s.spans...)
+}
+
+// Metrics() returns the metrics received so far, in the order they arrived.
+func (s *Server) Metrics() []Metric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Metric(nil), s.metrics...)
+}
+
+// Requests() returns every export received so far, including rejected ones.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Reset() discards all received telemetry and requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans = nil
+	s.metrics = nil
+	s.requests = nil
+}
+
+// RotateApiKey() changes the API key the server expects to apikey. The previous key is still
+// accepted for the grace period, so that tests can check how clients pick up a new key without
+// failing exports in between. The grace period is a feature of this fake server only, not of
+// Honeycomb, where a key is accepted until it is disabled or deleted.
+func (s *Server) RotateApiKey(apikey string, grace time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.previousApiKey = s.apiKey
+	s.previousApiKeyExpiry = time.Now().Add(grace)
+	s.apiKey = apikey
+}
+
+// authenticate checks the Honeycomb headers of an export, recording the request either way.
+func (s *Server) authenticate(protocol, signal string, headers map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch apikey := headers[apiKeyHeader]; {
+	case s.apiKey == "":
+	case apikey == "":
+		err = errMissingApiKey
+	case apikey == s.previousApiKey && time.Now().Before(s.previousApiKeyExpiry):
+	case apikey != s.apiKey:
+		err = errUnknownApiKey
+	}
+	if err == nil && s.dataset != "" && headers[datasetHeader] != s.dataset {
+		err = errWrongDataset
+	}
+
+	s.requests = append(s.requests, Request{
+		Protocol: protocol,
+		Signal:   signal,
+		Headers:  headers,
+		Err:      err,
+	})
+	return err
+}
+
+func (s *Server) storeTraces(request *collectortracepb.ExportTraceServiceRequest, headers map[string]string) {
+	spans := spansFromRequest(request, headers[datasetHeader])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans = append(s.spans, spans...)
+}
+
+func (s *Server) storeMetrics(request *collectormetricspb.ExportMetricsServiceRequest, headers map[string]string) {
+	metrics := metricsFromRequest(request, headers[datasetHeader])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, metrics...)
+}
+
+// ServeHTTP implements the OTLP/HTTP receiver, accepting protobuf and JSON encoded exports.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var signal string
+	var request, response proto.Message
+	switch r.URL.Path {
+	case "/v1/traces":
+		signal = "traces"
+		request, response = &collectortracepb.ExportTraceServiceRequest{}, &collectortracepb.ExportTraceServiceResponse{}
+	case "/v1/metrics":
+		signal = "metrics"
+		request, response = &collectormetricspb.ExportMetricsServiceRequest{}, &collectormetricspb.ExportMetricsServiceResponse{}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	headers := map[string]string{}
+	for key, values := range r.Header {
+		headers[strings.ToLower(key)] = strings.Join(values, ",")
+	}
+	if err := s.authenticate("http", signal, headers); err != nil {
+		code := http.StatusUnauthorized
+		if errors.Is(err, errWrongDataset) {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	if isJSON {
+		err = protojson.Unmarshal(data, request)
+	} else {
+		err = proto.Unmarshal(data, request)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch request := request.(type) {
+	case *collectortracepb.ExportTraceServiceRequest:
+		s.storeTraces(request, headers)
+	case *collectormetricspb.ExportMetricsServiceRequest:
+		s.storeMetrics(request, headers)
+	}
+
+	if isJSON {
+		data, err = protojson.Marshal(response)
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		data, err = proto.Marshal(response)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+// grpcHeaders flattens the incoming gRPC metadata of ctx.
+func grpcHeaders(ctx context.Context) map[string]string {
+	headers := map[string]string{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		headers[strings.ToLower(key)] = strings.Join(values, ",")
+	}
+	return headers
+}
+
+func grpcError(err error) error {
+	if errors.Is(err, errWrongDataset) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
+type traceService struct {
+	collectortracepb.UnimplementedTraceServiceServer
+	server *Server
+}
+
+func (t traceService) Export(ctx context.Context, request *collectortracepb.ExportTraceServiceRequest) (*collectortracepb.ExportTraceServiceResponse, error) {
+	headers := grpcHeaders(ctx)
+	if err := t.server.authenticate("grpc", "traces", headers); err != nil {
+		return nil, grpcError(err)
+	}
+	t.server.storeTraces(request, headers)
+	return &collectortracepb.ExportTraceServiceResponse{}, nil
+}
+
+type metricsService struct {
+	collectormetricspb.UnimplementedMetricsServiceServer
+	server *Server
+}
+
+func (m metricsService) Export(ctx context.Context, request *collectormetricspb.ExportMetricsServiceRequest) (*collectormetricspb.ExportMetricsServiceResponse, error) {
+	headers := grpcHeaders(ctx)
+	if err := m.server.authenticate("grpc", "metrics", headers); err != nil {
+		return nil, grpcError(err)
+	}
+	m.server.storeMetrics(request, headers)
+	return &collectormetricspb.ExportMetricsServiceResponse{}, nil
+}
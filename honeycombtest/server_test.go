@@ -0,0 +1,169 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycombtest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/honeycomb-opentelemetry-go"
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestServerReceivesSpansOverHTTP(t *testing.T) {
+	server := NewServer(t, WithApiKey("test-key"))
+	options := append(server.HTTPOptions(), honeycomb.WithApiKey("test-key"), otelconfig.WithServiceName("test-service"))
+	shutdown, err := otelconfig.ConfigureOpenTelemetry(options...)
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "http span")
+	span.SetAttributes(attribute.Int("count", 3), attribute.StringSlice("tags", []string{"a", "b"}))
+	span.End()
+	shutdown()
+
+	received := server.RequireSpan(t, "http span", map[string]interface{}{
+		"count":        3,
+		"tags":         []string{"a", "b"},
+		"service.name": "test-service",
+	})
+	assert.Equal(t, "test", received.ScopeName)
+	assert.Len(t, received.TraceID, 32)
+
+	requests := server.Requests()
+	require.NotEmpty(t, requests)
+	assert.Equal(t, "http", requests[0].Protocol)
+	assert.Equal(t, "traces", requests[0].Signal)
+	assert.Equal(t, "test-key", requests[0].Headers["x-honeycomb-team"])
+	assert.NoError(t, requests[0].Err)
+}
+
+func TestServerReceivesTelemetryOverGRPC(t *testing.T) {
+	server := NewServer(t, WithApiKey("test-key"), WithDataset("test-dataset"))
+	options := append(server.GRPCOptions(),
+		honeycomb.WithApiKey("test-key"),
+		honeycomb.WithDataset("test-dataset"),
+		otelconfig.WithMetricsEnabled(true),
+	)
+	shutdown, err := otelconfig.ConfigureOpenTelemetry(options...)
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "grpc span")
+	span.End()
+	counter, err := otel.Meter("test").Int64Counter("test.counter")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 1)
+	shutdown()
+
+	received := server.RequireSpan(t, "grpc span", nil)
+	assert.Equal(t, "test-dataset", received.Dataset)
+	metric := server.RequireMetric(t, "test.counter")
+	assert.Equal(t, "test", metric.ScopeName)
+	for _, request := range server.Requests() {
+		assert.Equal(t, "grpc", request.Protocol)
+		assert.NoError(t, request.Err)
+	}
+}
+
+func TestServerRejectsBadHeaders(t *testing.T) {
+	server := NewServer(t, WithApiKey("test-key"), WithDataset("test-dataset"))
+	spans := tracetest.SpanStubs{{Name: "rejected"}}.Snapshots()
+
+	testCases := []struct {
+		desc    string
+		headers map[string]string
+		err     error
+	}{
+		{desc: "missing API key", headers: map[string]string{}, err: errMissingApiKey},
+		{desc: "unknown API key", headers: map[string]string{"x-honeycomb-team": "other-key"}, err: errUnknownApiKey},
+		{desc: "wrong dataset", headers: map[string]string{"x-honeycomb-team": "test-key", "x-honeycomb-dataset": "other"}, err: errWrongDataset},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			server.Reset()
+			httpExporter, err := otlptracehttp.New(context.Background(),
+				otlptracehttp.WithEndpoint(server.HTTPEndpoint()),
+				otlptracehttp.WithInsecure(),
+				otlptracehttp.WithHeaders(tC.headers),
+				otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}),
+			)
+			require.NoError(t, err)
+			assert.Error(t, httpExporter.ExportSpans(context.Background(), spans))
+
+			grpcExporter, err := otlptracegrpc.New(context.Background(),
+				otlptracegrpc.WithEndpoint(server.GRPCEndpoint()),
+				otlptracegrpc.WithInsecure(),
+				otlptracegrpc.WithHeaders(tC.headers),
+				otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{Enabled: false}),
+			)
+			require.NoError(t, err)
+			assert.Error(t, grpcExporter.ExportSpans(context.Background(), spans))
+			_ = grpcExporter.Shutdown(context.Background())
+
+			assert.Empty(t, server.Spans())
+			requests := server.Requests()
+			require.Len(t, requests, 2)
+			for _, request := range requests {
+				assert.ErrorIs(t, request.Err, tC.err)
+			}
+		})
+	}
+}
+
+func TestServerAcceptsPreviousApiKeyDuringGracePeriod(t *testing.T) {
+	server := NewServer(t, WithApiKey("old-key"))
+	server.RotateApiKey("new-key", time.Hour)
+	assert.NoError(t, server.authenticate("http", "traces", map[string]string{"x-honeycomb-team": "old-key"}))
+	assert.NoError(t, server.authenticate("http", "traces", map[string]string{"x-honeycomb-team": "new-key"}))
+
+	server.RotateApiKey("newest-key", 0)
+	assert.ErrorIs(t, server.authenticate("http", "traces", map[string]string{"x-honeycomb-team": "new-key"}), errUnknownApiKey)
+	assert.ErrorIs(t, server.authenticate("http", "traces", map[string]string{"x-honeycomb-team": "old-key"}), errUnknownApiKey)
+	assert.NoError(t, server.authenticate("http", "traces", map[string]string{"x-honeycomb-team": "newest-key"}))
+}
+
+func TestServerAcceptsJSON(t *testing.T) {
+	server := NewServer(t)
+	body := `{"resourceSpans":[{"scopeSpans":[{"spans":[{"name":"json span","attributes":[{"key":"ok","value":{"boolValue":true}}]}]}]}]}`
+	response, err := http.Post("http://"+server.HTTPEndpoint()+"/v1/traces", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+
+	server.RequireSpan(t, "json span", map[string]interface{}{"ok": true})
+}
+
+func TestMatchAttributes(t *testing.T) {
+	span := map[string]interface{}{"count": int64(3), "ratio": 0.5}
+	resource := map[string]interface{}{"service.name": "svc", "count": int64(4)}
+	assert.True(t, matchAttributes(nil, span, resource))
+	assert.True(t, matchAttributes(map[string]interface{}{"count": 3, "ratio": float32(0.5)}, span, resource))
+	assert.True(t, matchAttributes(map[string]interface{}{"service.name": "svc"}, span, resource))
+	assert.False(t, matchAttributes(map[string]interface{}{"count": 4}, span, resource))
+	assert.True(t, matchAttributes(map[string]interface{}{"count": 3.0, "ratio": 0.5}, span, resource))
+	assert.True(t, matchAttributes(map[string]interface{}{"whole": 2}, map[string]interface{}{"whole": 2.0}))
+	assert.False(t, matchAttributes(map[string]interface{}{"ratio": 0}, span, resource))
+	assert.False(t, matchAttributes(map[string]interface{}{"missing": "value"}, span, resource))
+}
@@ -0,0 +1,249 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycombtest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	collectormetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Span is a span received by the server.
+//
+// Attribute values are converted to Go values: strings, bools, int64s, float64s, byte slices,
+// []interface{} for arrays and map[string]interface{} for key-value lists.
+type Span struct {
+	Name               string
+	TraceID            string
+	SpanID             string
+	ParentSpanID       string
+	Attributes         map[string]interface{}
+	ResourceAttributes map[string]interface{}
+	ScopeName          string
+	// Dataset is the x-honeycomb-dataset header the span was exported with, if any.
+	Dataset string
+	// Proto is the span as it was received.
+	Proto *tracepb.Span
+}
+
+// Metric is a metric received by the server.
+type Metric struct {
+	Name               string
+	ResourceAttributes map[string]interface{}
+	ScopeName          string
+	// Dataset is the x-honeycomb-dataset header the metric was exported with, if any.
+	Dataset string
+	// Proto is the metric as it was received, including its data points.
+	Proto *metricspb.Metric
+}
+
+// RequireSpan() waits for a span with the given name and attributes to be received, failing the
+// test if none arrives before the wait timeout. Attributes are matched against the span's own
+// attributes first and then against its resource attributes, so that for example "service.name"
+// can be checked. Numbers are compared by value regardless of their Go type, so that for example
+// 3 matches an attribute of 3.0.
+func (s *Server) RequireSpan(t testing.TB, name string, attrs map[string]interface{}) Span {
+	t.Helper()
+	var span Span
+	found := s.waitFor(func() bool {
+		for _, candidate := range s.Spans() {
+			if candidate.Name == name && matchAttributes(attrs, candidate.Attributes, candidate.ResourceAttributes) {
+				span = candidate
+				return true
+			}
+		}
+		return false
+	})
+	if !found {
+		var received []string
+		for _, candidate := range s.Spans() {
+			received = append(received, fmt.Sprintf("%q %v", candidate.Name, candidate.Attributes))
+		}
+		t.Fatalf("honeycombtest: no span named %q with attributes %v was received within %v; received:\n%s",
+			name, attrs, s.waitTimeout, strings.Join(received, "\n"))
+	}
+	return span
+}
+
+// RequireMetric() waits for a metric with the given name to be received, failing the test if none
+// arrives before the wait timeout.
+func (s *Server) RequireMetric(t testing.TB, name string) Metric {
+	t.Helper()
+	var metric Metric
+	found := s.waitFor(func() bool {
+		for _, candidate := range s.Metrics() {
+			if candidate.Name == name {
+				metric = candidate
+				return true
+			}
+		}
+		return false
+	})
+	if !found {
+		var received []string
+		for _, candidate := range s.Metrics() {
+			received = append(received, candidate.Name)
+		}
+		sort.Strings(received)
+		t.Fatalf("honeycombtest: no metric named %q was received within %v; received: %s",
+			name, s.waitTimeout, strings.Join(received, ", "))
+	}
+	return metric
+}
+
+func (s *Server) waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(s.waitTimeout)
+	for {
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func spansFromRequest(request *collectortracepb.ExportTraceServiceRequest, dataset string) []Span {
+	var spans []Span
+	for _, rs := range request.GetResourceSpans() {
+		resource := attributesToMap(rs.GetResource().GetAttributes())
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				spans = append(spans, Span{
+					Name:               span.GetName(),
+					TraceID:            hex.EncodeToString(span.GetTraceId()),
+					SpanID:             hex.EncodeToString(span.GetSpanId()),
+					ParentSpanID:       hex.EncodeToString(span.GetParentSpanId()),
+					Attributes:         attributesToMap(span.GetAttributes()),
+					ResourceAttributes: resource,
+					ScopeName:          ss.GetScope().GetName(),
+					Dataset:            dataset,
+					Proto:              span,
+				})
+			}
+		}
+	}
+	return spans
+}
+
+func metricsFromRequest(request *collectormetricspb.ExportMetricsServiceRequest, dataset string) []Metric {
+	var metrics []Metric
+	for _, rm := range request.GetResourceMetrics() {
+		resource := attributesToMap(rm.GetResource().GetAttributes())
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, metric := range sm.GetMetrics() {
+				metrics = append(metrics, Metric{
+					Name:               metric.GetName(),
+					ResourceAttributes: resource,
+					ScopeName:          sm.GetScope().GetName(),
+					Dataset:            dataset,
+					Proto:              metric,
+				})
+			}
+		}
+	}
+	return metrics
+}
+
+func attributesToMap(attrs []*commonpb.KeyValue) map[string]interface{} {
+	m := make(map[string]interface{}, len(attrs))
+	for _, attr := range attrs {
+		m[attr.GetKey()] = anyValue(attr.GetValue())
+	}
+	return m
+}
+
+func anyValue(v *commonpb.AnyValue) interface{} {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]interface{}, 0, len(v.ArrayValue.GetValues()))
+		for _, value := range v.ArrayValue.GetValues() {
+			values = append(values, anyValue(value))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		return attributesToMap(v.KvlistValue.GetValues())
+	default:
+		return nil
+	}
+}
+
+// matchAttributes reports whether every expected attribute is present, with an equal value, in
+// the first of the given attribute maps that has its key.
+func matchAttributes(expected map[string]interface{}, actual ...map[string]interface{}) bool {
+	for key, want := range expected {
+		matched := false
+		for _, attrs := range actual {
+			if got, ok := attrs[key]; ok {
+				matched = reflect.DeepEqual(normalize(want), normalize(got))
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize converts numbers to int64, or float64 if they aren't whole, and slices to
+// []interface{}, so that values can be compared with received attribute values.
+func normalize(v interface{}) interface{} {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		if f := value.Float(); f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f)
+		}
+		return value.Float()
+	case reflect.Slice, reflect.Array:
+		if _, isBytes := v.([]byte); isBytes {
+			return v
+		}
+		values := make([]interface{}, value.Len())
+		for i := range values {
+			values[i] = normalize(value.Index(i).Interface())
+		}
+		return values
+	default:
+		return v
+	}
+}
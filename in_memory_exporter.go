@@ -0,0 +1,116 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// InMemoryExporter records finished spans in memory so that tests can query them.
+//
+// Recorded spans are snapshots that include the span's resource, so the resource
+// attributes set by WithHoneycomb() can be checked alongside the span's own attributes.
+// Unlike tracetest.InMemoryExporter, shutting down does not discard recorded spans.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans tracetest.SpanStubs
+}
+
+var _ trace.SpanExporter = (*InMemoryExporter)(nil)
+
+// NewInMemoryExporter returns a new, empty in-memory span exporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// WithInMemoryExporter() configures an in-memory traces exporter for unit tests, returning the
+// exporter so that finished spans can be queried.
+//
+// Spans are recorded synchronously as they end, so they can be queried straight away without
+// flushing or shutting down. As with other exporters, only sampled spans are recorded.
+func WithInMemoryExporter() (otelconfig.Option, *InMemoryExporter) {
+	exporter := NewInMemoryExporter()
+	return otelconfig.WithSpanProcessor(trace.NewSimpleSpanProcessor(exporter)), exporter
+}
+
+func (e *InMemoryExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	stubs := tracetest.SpanStubsFromReadOnlySpans(spans)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, stubs...)
+	return nil
+}
+
+func (e *InMemoryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Spans returns every recorded span, in the order the spans ended.
+func (e *InMemoryExporter) Spans() tracetest.SpanStubs {
+	return e.filter(func(tracetest.SpanStub) bool { return true })
+}
+
+// SpansNamed returns the recorded spans with the given name.
+func (e *InMemoryExporter) SpansNamed(name string) tracetest.SpanStubs {
+	return e.filter(func(s tracetest.SpanStub) bool { return s.Name == name })
+}
+
+// SpansWithAttribute returns the recorded spans that have the given attribute,
+// either on the span itself or on its resource.
+func (e *InMemoryExporter) SpansWithAttribute(attr attribute.KeyValue) tracetest.SpanStubs {
+	return e.filter(func(s tracetest.SpanStub) bool {
+		for _, candidate := range s.Attributes {
+			if candidate == attr {
+				return true
+			}
+		}
+		if s.Resource != nil {
+			value, ok := s.Resource.Set().Value(attr.Key)
+			return ok && value == attr.Value
+		}
+		return false
+	})
+}
+
+// SpansInTrace returns the recorded spans belonging to the given trace.
+func (e *InMemoryExporter) SpansInTrace(traceID oteltrace.TraceID) tracetest.SpanStubs {
+	return e.filter(func(s tracetest.SpanStub) bool { return s.SpanContext.TraceID() == traceID })
+}
+
+// Reset discards all recorded spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+func (e *InMemoryExporter) filter(match func(tracetest.SpanStub) bool) tracetest.SpanStubs {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var spans tracetest.SpanStubs
+	for _, s := range e.spans {
+		if match(s) {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
@@ -0,0 +1,66 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/honeycombio/honeycomb-opentelemetry-go/honeycombtest"
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// useValidateConfig makes ConfigureOpenTelemetry() validate configs with validateConfig until the
+// test ends.
+func useValidateConfig(t *testing.T) {
+	previous := otelconfig.ValidateConfig
+	t.Cleanup(func() { otelconfig.ValidateConfig = previous })
+	otelconfig.ValidateConfig = validateConfig
+}
+
+func TestInMemoryExporterRecordsSpans(t *testing.T) {
+	useValidateConfig(t)
+
+	option, exporter := WithInMemoryExporter()
+	server := honeycombtest.NewServer(t)
+	shutdown, err := otelconfig.ConfigureOpenTelemetry(append(server.HTTPOptions(), option)...)
+	require.NoError(t, err)
+
+	tracer := otel.Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttributes(attribute.String("user.id", "123"))
+	child.End()
+	parent.End()
+	_, other := tracer.Start(context.Background(), "other")
+	other.End()
+
+	assert.Len(t, exporter.Spans(), 3)
+	require.Len(t, exporter.SpansNamed("child"), 1)
+	assert.Equal(t, "child", exporter.SpansWithAttribute(attribute.String("user.id", "123"))[0].Name)
+	assert.Len(t, exporter.SpansWithAttribute(attribute.String(honeycombDistroVersionKey, Version)), 3)
+	assert.Len(t, exporter.SpansInTrace(parent.SpanContext().TraceID()), 2)
+	assert.Empty(t, exporter.SpansNamed("missing"))
+
+	// spans are kept after shutting down, until reset
+	shutdown()
+	assert.Len(t, exporter.Spans(), 3)
+	exporter.Reset()
+	assert.Empty(t, exporter.Spans())
+}
@@ -0,0 +1,149 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+)
+
+// KeyValidationOption configures WithKeyValidation().
+type KeyValidationOption func(*keyValidator)
+
+// WithKeyValidationApiEndpoint() sets the Honeycomb API endpoint keys are validated against. By
+// default each key is validated against the exporter endpoint of the signal it is used for when
+// that is one of Honeycomb's, else Honeycomb's US API.
+func WithKeyValidationApiEndpoint(endpoint string) KeyValidationOption {
+	return func(v *keyValidator) {
+		v.apiEndpoint = endpoint
+	}
+}
+
+// WithKeyValidationTimeout() sets how long validating the API keys may delay startup, 5 seconds
+// by default.
+func WithKeyValidationTimeout(timeout time.Duration) KeyValidationOption {
+	return func(v *keyValidator) {
+		v.timeout = timeout
+	}
+}
+
+// WithKeyValidation() checks the API keys for traces and metrics with Honeycomb's /1/auth
+// endpoint when OpenTelemetry is configured, logging the team and environment each belongs to and
+// whether it can send telemetry at debug level. Keys that Honeycomb rejects, such as revoked keys,
+// or that can't send telemetry are always logged, or returned as an error with
+// WithStrictValidation(). Startup isn't affected if Honeycomb can't be reached.
+func WithKeyValidation(options ...KeyValidationOption) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		v := &keyValidator{auth: newAuthLookup(), timeout: authRequestTimeout}
+		for _, option := range options {
+			option(v)
+		}
+		stateFor(c).keyValidator = v
+	}
+}
+
+// keyValidator checks API keys with Honeycomb.
+type keyValidator struct {
+	auth        *authLookup
+	apiEndpoint string
+	timeout     time.Duration
+}
+
+// endpoint returns the Honeycomb API endpoint to validate keys for a signal exported to
+// exporterEndpoint against.
+func (v *keyValidator) endpoint(exporterEndpoint string) string {
+	if v.apiEndpoint != "" {
+		return v.apiEndpoint
+	}
+	if isHoneycombApiHost(endpointHost(exporterEndpoint)) {
+		return exporterEndpoint
+	}
+	return defaultApiEndpoint
+}
+
+// problems validates the API keys used by the enabled signals in c, returning the problems found.
+// Keys are always looked up from Honeycomb, rather than a cache, so revoked keys are noticed.
+func (v *keyValidator) problems(c *otelconfig.Config) []configProblem {
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+	var problems []configProblem
+	for _, k := range v.keys(c) {
+		signals := joinSignals(k.signals)
+		result, err := v.auth.fetch(ctx, k.endpoint, k.apikey)
+		switch {
+		case errors.Is(err, errAuthRejected):
+			problems = append(problems, configProblem{format: invalidApiKeyMessage, args: []interface{}{signals}, warn: true})
+		case err != nil:
+			if c.Logger != nil {
+				c.Logger.Debugf(keyValidationErrorMessage, signals, err)
+			}
+		default:
+			if c.Logger != nil {
+				c.Logger.Debugf(keyValidatedMessage, signals, result.Team.Slug, result.Environment.Slug, result.ApiKeyAccess.Events)
+			}
+			if !result.ApiKeyAccess.Events {
+				problems = append(problems, configProblem{format: apiKeyCannotSendMessage, args: []interface{}{signals}, warn: true})
+			}
+		}
+	}
+	return problems
+}
+
+// keyToValidate is an API key and the Honeycomb API endpoint to validate it against, for the
+// signals that send it.
+type keyToValidate struct {
+	endpoint string
+	apikey   string
+	signals  []string
+}
+
+// keys returns the API keys used by the enabled signals in c, each with the endpoint for the
+// signal it is used for, so that a key shared by signals sent to different Honeycomb regions is
+// validated in each of them.
+func (v *keyValidator) keys(c *otelconfig.Config) []*keyToValidate {
+	var keys []*keyToValidate
+	add := func(signal string, exporterEndpoint string, apikey string) {
+		if apikey == "" {
+			return
+		}
+		endpoint := v.endpoint(exporterEndpoint)
+		for _, k := range keys {
+			if k.endpoint == endpoint && k.apikey == apikey {
+				k.signals = append(k.signals, signal)
+				return
+			}
+		}
+		keys = append(keys, &keyToValidate{endpoint: endpoint, apikey: apikey, signals: []string{signal}})
+	}
+	if c.TracesEnabled {
+		endpoint, _, _ := tracesEndpoint(c)
+		add("traces", endpoint, tracesHeaders(c)[honeycombApiKeyHeader])
+	}
+	if c.MetricsEnabled {
+		endpoint, _, _ := metricsEndpoint(c)
+		add("metrics", endpoint, metricsHeaders(c)[honeycombApiKeyHeader])
+	}
+	return keys
+}
+
+func joinSignals(signals []string) string {
+	if len(signals) == 2 {
+		return signals[0] + " and " + signals[1]
+	}
+	return signals[0]
+}
@@ -0,0 +1,179 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newKeyValidationServer returns a fake Honeycomb /1/auth endpoint that accepts "write-key",
+// accepts "read-key" without permission to send events and rejects any other key.
+func newKeyValidationServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Honeycomb-Team") {
+		case "write-key":
+			_, _ = w.Write([]byte(`{"team":{"slug":"my-team"},"environment":{"slug":"my-env"},"api_key_access":{"events":true}}`))
+		case "read-key":
+			_, _ = w.Write([]byte(`{"team":{"slug":"my-team"},"environment":{"slug":"my-env"},"api_key_access":{"events":false}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestKeyValidation(t *testing.T) {
+	server := newKeyValidationServer(t)
+
+	testCases := []struct {
+		desc          string
+		apikey        string
+		expectedError string
+	}{
+		{desc: "key that can send events", apikey: "write-key"},
+		{desc: "key without permission to send events", apikey: "read-key", expectedError: "The API key for traces doesn't have permission to send events."},
+		{desc: "rejected key", apikey: "revoked-key", expectedError: "Honeycomb rejected the API key for traces."},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			config := freshConfig()
+			config.TracesEnabled = true
+			WithApiKey(tC.apikey)(config)
+			WithStrictValidation()(config)
+			WithKeyValidation(WithKeyValidationApiEndpoint(server.URL))(config)
+
+			err := validateConfig(config)
+			if tC.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tC.expectedError)
+			}
+		})
+	}
+}
+
+func TestKeyValidationLogsTeamAndEnvironment(t *testing.T) {
+	server := newKeyValidationServer(t)
+	config := freshConfig()
+	logger := &captureLogger{}
+	config.Logger = logger
+	config.TracesEnabled = true
+	config.MetricsEnabled = true
+	WithApiKey("write-key")(config)
+	WithKeyValidation(WithKeyValidationApiEndpoint(server.URL))(config)
+
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, keyValidatedMessage, logger.Format)
+	assert.Equal(t, []interface{}{"traces and metrics", "my-team", "my-env", true}, logger.Values)
+}
+
+func TestKeyValidationIgnoresUnreachableHoneycomb(t *testing.T) {
+	server := newKeyValidationServer(t)
+	server.Close()
+	config := freshConfig()
+	logger := &captureLogger{}
+	config.Logger = logger
+	config.TracesEnabled = true
+	WithApiKey("write-key")(config)
+	WithStrictValidation()(config)
+	WithKeyValidation(WithKeyValidationApiEndpoint(server.URL), WithKeyValidationTimeout(time.Second))(config)
+
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, keyValidationErrorMessage, logger.Format)
+}
+
+func TestKeyValidationEnvironmentVariable(t *testing.T) {
+	t.Setenv("HONEYCOMB_VALIDATE_API_KEY", "true")
+	config := freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+
+	validator := takeConfigState(config).keyValidator
+	require.NotNil(t, validator)
+	assert.Equal(t, "api.eu1.honeycomb.io:443", validator.endpoint("api.eu1.honeycomb.io:443"))
+	assert.Equal(t, defaultApiEndpoint, validator.endpoint("localhost:4317"))
+}
+
+func TestKeyValidationUsesEachSignalsEndpoint(t *testing.T) {
+	validator := &keyValidator{}
+	config := freshConfig()
+	config.TracesEnabled = true
+	config.MetricsEnabled = true
+	config.ExporterEndpoint = "localhost:4317"
+	config.TracesExporterEndpoint = "api.eu1.honeycomb.io:443"
+	WithApiKey("shared-key")(config)
+
+	// the same key is validated in each region it is sent to
+	assert.Equal(t, []*keyToValidate{
+		{endpoint: "api.eu1.honeycomb.io:443", apikey: "shared-key", signals: []string{"traces"}},
+		{endpoint: defaultApiEndpoint, apikey: "shared-key", signals: []string{"metrics"}},
+	}, validator.keys(config))
+
+	// and once when both signals are sent to the same one
+	config.MetricsExporterEndpoint = "api.eu1.honeycomb.io:443"
+	assert.Equal(t, []*keyToValidate{
+		{endpoint: "api.eu1.honeycomb.io:443", apikey: "shared-key", signals: []string{"traces", "metrics"}},
+	}, validator.keys(config))
+}
+
+// warnCaptureLogger also captures the last warning logged.
+type warnCaptureLogger struct {
+	captureLogger
+	WarnFormat string
+	WarnValues []interface{}
+}
+
+func (l *warnCaptureLogger) Warnf(format string, v ...interface{}) {
+	l.WarnFormat = format
+	l.WarnValues = v
+}
+
+func TestKeyValidationWarnsAboutRejectedKeys(t *testing.T) {
+	server := newKeyValidationServer(t)
+	config := freshConfig()
+	logger := &warnCaptureLogger{}
+	config.Logger = logger
+	config.TracesEnabled = true
+	WithApiKey("revoked-key")(config)
+	WithKeyValidation(WithKeyValidationApiEndpoint(server.URL))(config)
+
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, invalidApiKeyMessage, logger.WarnFormat)
+	assert.Equal(t, []interface{}{"traces"}, logger.WarnValues)
+
+	// loggers that can't log warnings are bypassed for the standard logger
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	config = freshConfig()
+	config.Logger = &captureLogger{}
+	config.TracesEnabled = true
+	WithApiKey("read-key")(config)
+	WithKeyValidation(WithKeyValidationApiEndpoint(server.URL))(config)
+
+	require.NoError(t, validateConfig(config))
+	assert.Contains(t, output.String(), "The API key for traces doesn't have permission to send events.")
+}
@@ -0,0 +1,182 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// keyedSpanExporter exports spans with an exporter created with the current API key, creating a
+// new one in place of the last when the key changes. The OTLP HTTP exporters send the headers
+// they were created with and have no hook to change them for each request, so this is how they
+// pick up a new key. Exports are made one at a time, as a batch span processor makes them anyway.
+type keyedSpanExporter struct {
+	headers map[string]string
+	apiKey  func() string
+	create  func(headers map[string]string) (trace.SpanExporter, error)
+
+	mu       sync.Mutex
+	key      string
+	exporter trace.SpanExporter
+	stopped  bool
+}
+
+var _ trace.SpanExporter = (*keyedSpanExporter)(nil)
+
+// newKeyedSpanExporter returns a span exporter that exports with an exporter returned by create
+// for headers, with the API key header set to the key returned by apiKey, if not empty.
+func newKeyedSpanExporter(headers map[string]string, apiKey func() string, create func(headers map[string]string) (trace.SpanExporter, error)) (*keyedSpanExporter, error) {
+	e := &keyedSpanExporter{headers: headers, apiKey: apiKey, create: create}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.current(context.Background()); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// current returns the exporter for the current API key, shutting down the previous one if the
+// key has changed. It must be called with mu held.
+func (e *keyedSpanExporter) current(ctx context.Context) (trace.SpanExporter, error) {
+	key := e.apiKey()
+	if e.exporter != nil && (key == e.key || e.stopped) {
+		return e.exporter, nil
+	}
+	exporter, err := e.create(withApiKeyHeader(e.headers, key))
+	if err != nil {
+		return nil, err
+	}
+	if e.exporter != nil {
+		_ = e.exporter.Shutdown(ctx)
+	}
+	e.key, e.exporter = key, exporter
+	return exporter, nil
+}
+
+func (e *keyedSpanExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	exporter, err := e.current(ctx)
+	if err != nil {
+		return err
+	}
+	return exporter.ExportSpans(ctx, spans)
+}
+
+func (e *keyedSpanExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stopped = true
+	return e.exporter.Shutdown(ctx)
+}
+
+// keyedMetricExporter is the metric exporter equivalent of keyedSpanExporter. Exports are made
+// one at a time, as a periodic reader makes them anyway.
+type keyedMetricExporter struct {
+	headers map[string]string
+	apiKey  func() string
+	create  func(headers map[string]string) (metric.Exporter, error)
+
+	mu       sync.Mutex
+	key      string
+	exporter metric.Exporter
+	stopped  bool
+}
+
+var _ metric.Exporter = (*keyedMetricExporter)(nil)
+
+// newKeyedMetricExporter returns a metric exporter that exports with an exporter returned by
+// create, like newKeyedSpanExporter.
+func newKeyedMetricExporter(headers map[string]string, apiKey func() string, create func(headers map[string]string) (metric.Exporter, error)) (*keyedMetricExporter, error) {
+	e := &keyedMetricExporter{headers: headers, apiKey: apiKey, create: create}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.current(context.Background()); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// current returns the exporter for the current API key, like keyedSpanExporter's. It must be
+// called with mu held.
+func (e *keyedMetricExporter) current(ctx context.Context) (metric.Exporter, error) {
+	key := e.apiKey()
+	if e.exporter != nil && (key == e.key || e.stopped) {
+		return e.exporter, nil
+	}
+	exporter, err := e.create(withApiKeyHeader(e.headers, key))
+	if err != nil {
+		return nil, err
+	}
+	if e.exporter != nil {
+		_ = e.exporter.Shutdown(ctx)
+	}
+	e.key, e.exporter = key, exporter
+	return exporter, nil
+}
+
+func (e *keyedMetricExporter) Temporality(kind metric.InstrumentKind) metricdata.Temporality {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exporter.Temporality(kind)
+}
+
+func (e *keyedMetricExporter) Aggregation(kind metric.InstrumentKind) metric.Aggregation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exporter.Aggregation(kind)
+}
+
+func (e *keyedMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	exporter, err := e.current(ctx)
+	if err != nil {
+		return err
+	}
+	return exporter.Export(ctx, rm)
+}
+
+func (e *keyedMetricExporter) ForceFlush(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exporter.ForceFlush(ctx)
+}
+
+func (e *keyedMetricExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stopped = true
+	return e.exporter.Shutdown(ctx)
+}
+
+// withApiKeyHeader returns a copy of headers with the API key header set to key, or headers
+// itself if key is empty.
+func withApiKeyHeader(headers map[string]string, key string) map[string]string {
+	if key == "" {
+		return headers
+	}
+	keyed := make(map[string]string, len(headers)+1)
+	for name, value := range headers {
+		keyed[name] = value
+	}
+	keyed[honeycombApiKeyHeader] = key
+	return keyed
+}
@@ -0,0 +1,298 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultLocalUIMaxTraces = 100
+	localUIBatchTimeout     = time.Second
+)
+
+// localUI keeps the most recent traces in a ring buffer and serves a web UI for browsing them.
+type localUI struct {
+	traces *traceAssembler
+
+	mu     sync.Mutex
+	recent []*localTrace
+	next   int
+}
+
+var _ trace.SpanExporter = (*localUI)(nil)
+var _ http.Handler = (*localUI)(nil)
+
+// WithLocalUI() serves a web UI at addr, such as ":7777", for browsing the last maxTraces traces,
+// or 100 traces if maxTraces is not positive. Each trace is shown as a waterfall of its spans
+// once its root span ends. This is intended for local development; the UI has no authentication,
+// so it only listens on 127.0.0.1 when addr has no host. The server starts once the config has
+// been validated, and stops when OpenTelemetry is shut down. If it can't listen on addr, that is
+// reported like other misconfigurations. Nothing is started when traces are disabled.
+func WithLocalUI(addr string, maxTraces int) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		state := stateFor(c)
+		withSetup(func(c *otelconfig.Config) (func(), error) {
+			if !c.TracesEnabled {
+				return nil, nil
+			}
+			listener, err := net.Listen("tcp", localUIAddr(addr))
+			if err != nil {
+				return nil, state.reportProblem(c, configProblem{format: "%s\n%v", args: []interface{}{localUIErrorMessage, err}})
+			}
+			ui := newLocalUI(maxTraces)
+			server := &http.Server{Handler: ui, ReadHeaderTimeout: 5 * time.Second}
+			go func() {
+				_ = server.Serve(listener)
+			}()
+			c.SpanProcessors = append(c.SpanProcessors, trace.NewBatchSpanProcessor(ui, trace.WithBatchTimeout(localUIBatchTimeout)))
+			return func() {
+				_ = server.Close()
+			}, nil
+		})(c)
+	}
+}
+
+// localUIAddr returns addr, listening on the loopback address if it doesn't name a host.
+func localUIAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+func newLocalUI(maxTraces int) *localUI {
+	if maxTraces <= 0 {
+		maxTraces = defaultLocalUIMaxTraces
+	}
+	return &localUI{
+		traces: newTraceAssembler(defaultMaxPendingTraces),
+		recent: make([]*localTrace, maxTraces),
+	}
+}
+
+func (ui *localUI) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	completed := ui.traces.add(spans)
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	for _, t := range completed {
+		ui.recent[ui.next] = t
+		ui.next = (ui.next + 1) % len(ui.recent)
+	}
+	return nil
+}
+
+func (ui *localUI) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// recentTraces returns the buffered traces, most recent first.
+func (ui *localUI) recentTraces() []*localTrace {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	var traces []*localTrace
+	for i := 1; i <= len(ui.recent); i++ {
+		if t := ui.recent[(ui.next-i+len(ui.recent))%len(ui.recent)]; t != nil {
+			traces = append(traces, t)
+		}
+	}
+	return traces
+}
+
+func (ui *localUI) findTrace(id oteltrace.TraceID) *localTrace {
+	for _, t := range ui.recentTraces() {
+		if t.id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func (ui *localUI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/":
+		ui.serveTraceList(w)
+	case strings.HasPrefix(r.URL.Path, "/traces/"):
+		id, err := oteltrace.TraceIDFromHex(strings.TrimPrefix(r.URL.Path, "/traces/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		t := ui.findTrace(id)
+		if t == nil {
+			http.NotFound(w, r)
+			return
+		}
+		ui.serveTrace(w, t)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type traceListRow struct {
+	ID       string
+	Name     string
+	Start    string
+	Duration string
+	Spans    int
+	Error    bool
+}
+
+func (ui *localUI) serveTraceList(w http.ResponseWriter) {
+	var rows []traceListRow
+	for _, t := range ui.recentTraces() {
+		start := t.start()
+		rows = append(rows, traceListRow{
+			ID:       t.id.String(),
+			Name:     t.root.Name(),
+			Start:    start.Format("15:04:05.000"),
+			Duration: formatSpanDuration(t.end().Sub(start)),
+			Spans:    len(t.spans),
+			Error:    t.hasError(),
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = localUITemplates.ExecuteTemplate(w, "list", rows)
+}
+
+type waterfallRow struct {
+	Name       string
+	Depth      int
+	Offset     float64
+	Width      float64
+	Duration   string
+	Error      bool
+	Status     string
+	Attributes []waterfallAttribute
+}
+
+type waterfallAttribute struct {
+	Key   string
+	Value string
+}
+
+type waterfallPage struct {
+	ID       string
+	Name     string
+	Duration string
+	Rows     []waterfallRow
+}
+
+func (ui *localUI) serveTrace(w http.ResponseWriter, t *localTrace) {
+	page := waterfallPage{ID: t.id.String(), Name: t.root.Name(), Rows: waterfallRows(t)}
+	page.Duration = formatSpanDuration(t.end().Sub(t.start()))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = localUITemplates.ExecuteTemplate(w, "trace", page)
+}
+
+// waterfallRows flattens the span tree of t, giving each span's position as percentages of the
+// trace's duration.
+func waterfallRows(t *localTrace) []waterfallRow {
+	start := t.start()
+	total := float64(t.end().Sub(start))
+	var rows []waterfallRow
+	var walk func(node *spanNode, depth int)
+	walk = func(node *spanNode, depth int) {
+		s := node.span
+		row := waterfallRow{
+			Name:     s.Name(),
+			Depth:    depth,
+			Width:    100,
+			Duration: formatSpanDuration(s.EndTime().Sub(s.StartTime())),
+			Error:    isErrorSpan(s),
+			Status:   s.Status().Description,
+		}
+		if total > 0 {
+			row.Offset = float64(s.StartTime().Sub(start)) / total * 100
+			row.Width = max(float64(s.EndTime().Sub(s.StartTime()))/total*100, 0.5)
+		}
+		for _, attr := range s.Attributes() {
+			row.Attributes = append(row.Attributes, waterfallAttribute{Key: string(attr.Key), Value: attr.Value.Emit()})
+		}
+		rows = append(rows, row)
+		for _, child := range node.children {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range buildSpanTree(t.spans) {
+		walk(root, 0)
+	}
+	return rows
+}
+
+var localUITemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"indent": func(depth int) int { return depth * 16 },
+}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.}} - Honeycomb local traces</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #eee; vertical-align: top; }
+.error { color: #c00; }
+.bar-cell { width: 50%; }
+.bar { position: relative; height: 14px; }
+.bar span { position: absolute; height: 100%; background: #f5a623; }
+.bar span.error { background: #c00; }
+details summary { cursor: pointer; }
+</style></head><body>{{end}}
+
+{{define "list"}}{{template "head" "Recent traces"}}
+<h1>Recent traces</h1>
+{{if .}}<table>
+<tr><th>Start</th><th>Root span</th><th>Duration</th><th>Spans</th><th></th></tr>
+{{range .}}<tr>
+<td>{{.Start}}</td>
+<td><a href="/traces/{{.ID}}">{{.Name}}</a></td>
+<td>{{.Duration}}</td>
+<td>{{.Spans}}</td>
+<td>{{if .Error}}<span class="error">error</span>{{end}}</td>
+</tr>{{end}}
+</table>{{else}}<p>No traces yet. Traces appear here once their root span ends.</p>{{end}}
+</body></html>{{end}}
+
+{{define "trace"}}{{template "head" .Name}}
+<p><a href="/">&larr; Recent traces</a></p>
+<h1>{{.Name}}</h1>
+<p>Trace {{.ID}}, {{.Duration}}</p>
+<table>
+<tr><th>Span</th><th>Duration</th><th class="bar-cell"></th></tr>
+{{range .Rows}}<tr>
+<td style="padding-left: {{indent .Depth}}px"><details><summary{{if .Error}} class="error"{{end}}>{{.Name}}</summary>
+{{if .Status}}<div class="error">{{.Status}}</div>{{end}}
+{{range .Attributes}}<div>{{.Key}} = {{.Value}}</div>{{end}}
+</details></td>
+<td>{{.Duration}}</td>
+<td class="bar-cell"><div class="bar"><span{{if .Error}} class="error"{{end}} style="left: {{printf "%.2f" .Offset}}%; width: {{printf "%.2f" .Width}}%"></span></div></td>
+</tr>{{end}}
+</table>
+</body></html>{{end}}
+`))
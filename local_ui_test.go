@@ -0,0 +1,162 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func getLocalUI(t *testing.T, ui *localUI, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ui.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestLocalUIKeepsMostRecentTraces(t *testing.T) {
+	ui := newLocalUI(2)
+	for i := byte(1); i <= 3; i++ {
+		require.NoError(t, ui.ExportSpans(context.Background(), tracetest.SpanStubs{
+			treeTestSpan(i, 1, 0, "root", 0, 10),
+		}.Snapshots()))
+	}
+
+	traces := ui.recentTraces()
+	require.Len(t, traces, 2)
+	assert.Equal(t, byte(3), traces[0].id[15])
+	assert.Equal(t, byte(2), traces[1].id[15])
+}
+
+func TestLocalUIServesTraceListAndWaterfall(t *testing.T) {
+	ui := newLocalUI(0)
+	failed := treeTestSpan(1, 2, 1, "SELECT <users>", 10, 30)
+	failed.Status.Code = codes.Error
+	failed.Status.Description = "connection reset"
+	require.NoError(t, ui.ExportSpans(context.Background(), tracetest.SpanStubs{
+		failed,
+		treeTestSpan(1, 1, 0, "GET /users", 0, 40),
+	}.Snapshots()))
+
+	list := getLocalUI(t, ui, "/")
+	assert.Equal(t, http.StatusOK, list.Code)
+	assert.Contains(t, list.Body.String(), `<a href="/traces/00000000000000000000000000000001">GET /users</a>`)
+	assert.Contains(t, list.Body.String(), "40.0ms")
+
+	page := getLocalUI(t, ui, "/traces/00000000000000000000000000000001")
+	assert.Equal(t, http.StatusOK, page.Code)
+	assert.Contains(t, page.Body.String(), "SELECT &lt;users&gt;")
+	assert.Contains(t, page.Body.String(), "connection reset")
+	assert.Contains(t, page.Body.String(), "left: 25.00%; width: 50.00%")
+
+	assert.Equal(t, http.StatusNotFound, getLocalUI(t, ui, "/traces/00000000000000000000000000000002").Code)
+	assert.Equal(t, http.StatusNotFound, getLocalUI(t, ui, "/traces/not-a-trace").Code)
+	assert.Equal(t, http.StatusNotFound, getLocalUI(t, ui, "/other").Code)
+}
+
+func TestWithLocalUIServesUntilShutdown(t *testing.T) {
+	config := freshConfig()
+	config.TracesEnabled = true
+	WithApiKey("123456789012345678901")(config)
+	WithLocalUI("127.0.0.1:0", 10)(config)
+
+	// nothing is started until the config has been validated
+	assert.Empty(t, config.SpanProcessors)
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, 1, len(config.SpanProcessors))
+	require.Len(t, config.ShutdownFunctions, 1)
+	assert.NoError(t, config.ShutdownFunctions[0](config))
+}
+
+func TestWithLocalUIReportsAddressInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	config := freshConfig()
+	config.TracesEnabled = true
+	logger := &captureLogger{}
+	config.Logger = logger
+	WithApiKey("123456789012345678901")(config)
+	WithLocalUI(listener.Addr().String(), 10)(config)
+	require.NoError(t, validateConfig(config))
+	assert.Empty(t, config.SpanProcessors)
+	assert.Equal(t, localUIErrorMessage, logger.Values[0])
+
+	// or returned with strict validation
+	config = freshConfig()
+	config.TracesEnabled = true
+	WithApiKey("123456789012345678901")(config)
+	WithLocalUI(listener.Addr().String(), 10)(config)
+	WithStrictValidation()(config)
+	assert.ErrorContains(t, validateConfig(config), localUIErrorMessage)
+	assert.Empty(t, config.ShutdownFunctions)
+}
+
+func TestLocalUIAddrDefaultsToLoopback(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:7777", localUIAddr(":7777"))
+	assert.Equal(t, "0.0.0.0:7777", localUIAddr("0.0.0.0:7777"))
+	assert.Equal(t, "localhost:7777", localUIAddr("localhost:7777"))
+}
+
+func TestSettingLocalUIAddrAddsLocalUI(t *testing.T) {
+	config := freshConfig()
+	config.TracesEnabled = true
+	t.Setenv("HONEYCOMB_LOCAL_UI_ADDR", "127.0.0.1:0")
+	t.Setenv("HONEYCOMB_API_KEY", "123456789012345678901")
+
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	require.NoError(t, validateConfig(config))
+
+	assert.Equal(t, 1, len(config.SpanProcessors))
+	for _, shutdown := range config.ShutdownFunctions {
+		assert.NoError(t, shutdown(config))
+	}
+}
+
+func TestWithLocalUIDoesNothingWithTracesDisabled(t *testing.T) {
+	config := freshConfig()
+	WithApiKey("123456789012345678901")(config)
+	WithLocalUI("127.0.0.1:0", 10)(config)
+	require.NoError(t, validateConfig(config))
+	assert.Empty(t, config.SpanProcessors)
+	assert.Empty(t, config.ShutdownFunctions)
+}
+
+func TestInvalidLocalUIMaxTracesIsReported(t *testing.T) {
+	t.Setenv("HONEYCOMB_LOCAL_UI_ADDR", "127.0.0.1:0")
+	t.Setenv("HONEYCOMB_LOCAL_UI_MAX_TRACES", "lots")
+	config := freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	state := takeConfigState(config)
+	var reported bool
+	for _, problem := range state.problems {
+		if problem.format == invalidSettingMessage && problem.args[0] == "HONEYCOMB_LOCAL_UI_MAX_TRACES" {
+			reported = true
+		}
+	}
+	assert.True(t, reported)
+}
@@ -0,0 +1,106 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// honeycombTraceStateKey is the W3C tracestate entry used to propagate the sample rate.
+	honeycombTraceStateKey = "hny"
+	// traceStateSampleRatePrefix prefixes the sample rate within the hny tracestate entry, e.g. "sr:10".
+	traceStateSampleRatePrefix = "sr:"
+)
+
+// parentBasedSampler honors the sampling decision of a span's parent and propagates the
+// sample rate chosen at the root of the trace in the W3C tracestate, so that every span
+// in a distributed trace carries the same SampleRate attribute.
+type parentBasedSampler struct {
+	root trace.Sampler
+}
+
+var _ trace.Sampler = parentBasedSampler{}
+
+// Returns a new sampler that respects the parent span's sampling decision.
+//
+// Spans with a sampled parent are sampled and given the SampleRate found in the parent's
+// "hny" tracestate entry. Spans with an unsampled parent are dropped. Spans without a parent
+// are sampled by root, and the SampleRate it records is written to the tracestate so that
+// it propagates to child spans, including those in downstream services.
+func NewParentBasedSampler(root trace.Sampler) trace.Sampler {
+	return parentBasedSampler{root: root}
+}
+
+// WithParentBasedSampling() wraps the configured sampler so that it is only used for root spans,
+// and other spans follow their parent's sampling decision and sample rate. It wraps the sampler
+// in use once all options have been applied, whichever option sets it.
+func WithParentBasedSampling() otelconfig.Option {
+	return withSamplerWrapper(NewParentBasedSampler)
+}
+
+func (s parentBasedSampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
+	parent := oteltrace.SpanContextFromContext(parameters.ParentContext)
+	if parent.IsValid() {
+		ts := parent.TraceState()
+		if !parent.IsSampled() {
+			return trace.SamplingResult{Decision: trace.Drop, Tracestate: ts}
+		}
+		result := trace.SamplingResult{Decision: trace.RecordAndSample, Tracestate: ts}
+		if rate, ok := sampleRateFromTraceState(ts); ok {
+			result.Attributes = []attribute.KeyValue{sampleRateAttributeKey.Int(rate)}
+		}
+		return result
+	}
+
+	result := s.root.ShouldSample(parameters)
+	if result.Decision != trace.RecordAndSample {
+		return result
+	}
+	for _, attr := range result.Attributes {
+		if attr.Key == sampleRateAttributeKey {
+			ts, err := result.Tracestate.Insert(honeycombTraceStateKey, traceStateSampleRatePrefix+strconv.FormatInt(attr.Value.AsInt64(), 10))
+			if err == nil {
+				result.Tracestate = ts
+			}
+			break
+		}
+	}
+	return result
+}
+
+func (s parentBasedSampler) Description() string {
+	return fmt.Sprintf("ParentBasedSampler{%s}", s.root.Description())
+}
+
+// sampleRateFromTraceState reads the sample rate from the hny tracestate entry.
+func sampleRateFromTraceState(ts oteltrace.TraceState) (int, bool) {
+	value := ts.Get(honeycombTraceStateKey)
+	if !strings.HasPrefix(value, traceStateSampleRatePrefix) {
+		return 0, false
+	}
+	rate, err := strconv.Atoi(strings.TrimPrefix(value, traceStateSampleRatePrefix))
+	if err != nil || rate < 1 {
+		return 0, false
+	}
+	return rate, true
+}
@@ -0,0 +1,145 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func remoteParentContext(t *testing.T, sampled bool, tracestate string) context.Context {
+	ts, err := oteltrace.ParseTraceState(tracestate)
+	require.NoError(t, err)
+	flags := oteltrace.TraceFlags(0)
+	if sampled {
+		flags = oteltrace.FlagsSampled
+	}
+	sc := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    oteltrace.TraceID{0x01},
+		SpanID:     oteltrace.SpanID{0x01},
+		TraceFlags: flags,
+		TraceState: ts,
+		Remote:     true,
+	})
+	return oteltrace.ContextWithRemoteSpanContext(context.Background(), sc)
+}
+
+func TestParentBasedSamplerWritesSampleRateForRootSpans(t *testing.T) {
+	sampler := NewParentBasedSampler(NewDeterministicSampler(1))
+	assert.Equal(t, "ParentBasedSampler{DeterministicSampler}", sampler.Description())
+
+	result := sampler.ShouldSample(trace.SamplingParameters{ParentContext: context.Background()})
+	assert.Equal(t, trace.RecordAndSample, result.Decision)
+	assert.Equal(t, "sr:1", result.Tracestate.Get("hny"))
+}
+
+func TestParentBasedSamplerFollowsParent(t *testing.T) {
+	// the root sampler would drop everything, so any sampled span followed its parent
+	sampler := NewParentBasedSampler(NewDeterministicSampler(0))
+
+	testCases := []struct {
+		desc               string
+		sampled            bool
+		tracestate         string
+		expectedDecision   trace.SamplingDecision
+		expectedSampleRate int64
+	}{
+		{
+			desc:               "sampled parent with sample rate",
+			sampled:            true,
+			tracestate:         "hny=sr:20,vendor=value",
+			expectedDecision:   trace.RecordAndSample,
+			expectedSampleRate: 20,
+		},
+		{
+			desc:             "sampled parent without sample rate",
+			sampled:          true,
+			tracestate:       "vendor=value",
+			expectedDecision: trace.RecordAndSample,
+		},
+		{
+			desc:             "unsampled parent",
+			sampled:          false,
+			tracestate:       "hny=sr:20",
+			expectedDecision: trace.Drop,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctx := remoteParentContext(t, tC.sampled, tC.tracestate)
+			result := sampler.ShouldSample(trace.SamplingParameters{ParentContext: ctx})
+			assert.Equal(t, tC.expectedDecision, result.Decision)
+			// the tracestate is propagated unchanged
+			assert.Equal(t, tC.tracestate, result.Tracestate.String())
+
+			attr := getAttributeWithKey(result.Attributes, "SampleRate")
+			if tC.expectedSampleRate == 0 {
+				assert.Nil(t, attr)
+				return
+			}
+			if attr == nil {
+				t.Fatalf("SampleRate attribute was not found")
+			}
+			assert.Equal(t, tC.expectedSampleRate, attr.Value.AsInt64())
+		})
+	}
+}
+
+func TestParentBasedSamplerPropagatesSampleRateThroughTrace(t *testing.T) {
+	exporter := NewTestExporter()
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(NewParentBasedSampler(NewDeterministicSampler(1))),
+		trace.WithSpanProcessor(trace.NewSimpleSpanProcessor(exporter)),
+	)
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	root.End()
+
+	require.Equal(t, 2, len(exporter.spans))
+	for _, s := range exporter.spans {
+		attr := getAttributeWithKey(s.Attributes(), "SampleRate")
+		if attr == nil {
+			t.Fatalf("SampleRate attribute was not found")
+		}
+		assert.Equal(t, int64(1), attr.Value.AsInt64())
+		assert.Equal(t, "sr:1", s.SpanContext().TraceState().Get("hny"))
+	}
+}
+
+func TestConfigureParentBasedSampling(t *testing.T) {
+	t.Setenv("SAMPLE_RATE", "10")
+	t.Setenv("HONEYCOMB_SAMPLER_PARENT_BASED", "true")
+	config := freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	takeConfigState(config).applySamplers(config)
+	assert.Equal(t, "ParentBasedSampler{DeterministicSampler}", config.Sampler.Description())
+
+	// the sampler is wrapped whichever option sets it
+	config = freshConfig()
+	WithParentBasedSampling()(config)
+	WithSampler(5)(config)
+	takeConfigState(config).applySamplers(config)
+	assert.Equal(t, "ParentBasedSampler{DeterministicSampler}", config.Sampler.Description())
+}
@@ -0,0 +1,182 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	hostMetrics "go.opentelemetry.io/contrib/instrumentation/host"
+	runtimeMetrics "go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/ot"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newConfigTraceExporter returns an exporter for the traces endpoint in c, which sends the current
+// API key from keys, if it provides one for traces.
+func newConfigTraceExporter(c *otelconfig.Config, keys *apiKeyProviders) (trace.SpanExporter, error) {
+	endpoint, insecure, protocol := tracesEndpoint(c)
+	if endpoint == "" {
+		return nil, fmt.Errorf("no traces endpoint configured")
+	}
+	var apiKey func() string
+	if keys.hasTracesKey() {
+		apiKey = keys.tracesKey
+	}
+	return newTraceExporter(protocol, endpoint, insecure, tracesHeaders(c), apiKey)
+}
+
+// newConfigMetricExporter returns an exporter for the metrics endpoint in c, which sends the
+// current API key from keys, if it provides one for metrics.
+func newConfigMetricExporter(c *otelconfig.Config, keys *apiKeyProviders) (metric.Exporter, error) {
+	endpoint, insecure, protocol := metricsEndpoint(c)
+	if endpoint == "" {
+		return nil, fmt.Errorf("no metrics endpoint configured")
+	}
+	var apiKey func() string
+	if keys.hasMetricsKey() {
+		apiKey = keys.metricsKey
+	}
+	return newMetricExporter(protocol, endpoint, insecure, metricsHeaders(c), apiKey)
+}
+
+// watchApiKeys is a setup step that refreshes the API keys from keys until shut down.
+func watchApiKeys(keys *apiKeyProviders) setupStep {
+	return func(c *otelconfig.Config) (func(), error) {
+		return keys.watch(c.Logger), nil
+	}
+}
+
+// setupPipelines is a setup step that sets up the traces pipeline when spans are exported by
+// exportSpans, if not nil, or with an API key from keys, and the metrics pipeline when metrics are
+// sent with an API key from keys, and stops otelconfig from setting these up itself.
+//
+// otelconfig always exports spans with a batch span processor and creates its exporters with
+// the headers it is configured with, with no way to change either afterwards, so these pipelines
+// are set up the way its pipelines package does, but with the given export stage and with
+// exporters that send the current key with each export. Nothing is installed globally until
+// both pipelines have been created, so a failure leaves the previous providers in place.
+//
+// This mirrors setupTracing and setupMetrics in otelconfig v1.15.0 and its pipelines package, and
+// should be removed in favour of otelconfig's own pipelines once it accepts a factory for the span
+// exporter and the span processor that exports to it; until then, keep the two in sync when
+// upgrading otelconfig.
+func setupPipelines(keys *apiKeyProviders, exportSpans func(trace.SpanExporter) trace.SpanProcessor) setupStep {
+	return func(c *otelconfig.Config) (func(), error) {
+		var tp *trace.TracerProvider
+		var mp *metric.MeterProvider
+		stop := func() {
+			if tp != nil {
+				_ = tp.Shutdown(context.Background())
+			}
+			if mp != nil {
+				_ = mp.Shutdown(context.Background())
+			}
+		}
+		fail := func(err error) (func(), error) {
+			stop()
+			return nil, err
+		}
+
+		var propagator propagation.TextMapPropagator
+		if endpoint, _, _ := tracesEndpoint(c); c.TracesEnabled && endpoint != "" && (exportSpans != nil || keys.hasTracesKey()) {
+			var err error
+			if propagator, err = newPropagator(c.Propagators); err != nil {
+				return fail(err)
+			}
+			exporter, err := newConfigTraceExporter(c, keys)
+			if err != nil {
+				return fail(fmt.Errorf("failed to create span exporter: %w", err))
+			}
+			opts := []trace.TracerProviderOption{
+				trace.WithResource(c.Resource),
+				trace.WithSampler(c.Sampler),
+			}
+			for _, sp := range c.SpanProcessors {
+				opts = append(opts, trace.WithSpanProcessor(sp))
+			}
+			if exportSpans == nil {
+				exportSpans = func(exporter trace.SpanExporter) trace.SpanProcessor {
+					return trace.NewBatchSpanProcessor(exporter)
+				}
+			}
+			opts = append(opts, trace.WithSpanProcessor(exportSpans(exporter)))
+			tp = trace.NewTracerProvider(opts...)
+		}
+
+		if endpoint, _, _ := metricsEndpoint(c); c.MetricsEnabled && endpoint != "" && keys.hasMetricsKey() {
+			var readerOpts []metric.PeriodicReaderOption
+			if c.MetricsReportingPeriod != "" {
+				period, err := time.ParseDuration(c.MetricsReportingPeriod)
+				if err != nil || period <= 0 {
+					return fail(fmt.Errorf("invalid metric reporting period: %v", c.MetricsReportingPeriod))
+				}
+				readerOpts = append(readerOpts, metric.WithInterval(period))
+			}
+			exporter, err := newConfigMetricExporter(c, keys)
+			if err != nil {
+				return fail(fmt.Errorf("failed to create metric exporter: %w", err))
+			}
+			mp = metric.NewMeterProvider(
+				metric.WithResource(c.Resource),
+				metric.WithReader(metric.NewPeriodicReader(exporter, readerOpts...)),
+			)
+			if err := runtimeMetrics.Start(runtimeMetrics.WithMeterProvider(mp)); err != nil {
+				return fail(fmt.Errorf("failed to start runtime metrics: %w", err))
+			}
+			if err := hostMetrics.Start(hostMetrics.WithMeterProvider(mp)); err != nil {
+				return fail(fmt.Errorf("failed to start host metrics: %w", err))
+			}
+		}
+
+		if tp != nil {
+			otel.SetTextMapPropagator(propagator)
+			otel.SetTracerProvider(tp)
+			c.TracesEnabled = false
+		}
+		if mp != nil {
+			otel.SetMeterProvider(mp)
+			c.MetricsEnabled = false
+		}
+		return stop, nil
+	}
+}
+
+// newPropagator returns the propagators named in names, which are the ones otelconfig supports.
+func newPropagator(names []string) (propagation.TextMapPropagator, error) {
+	propagatorsMap := map[string]propagation.TextMapPropagator{
+		"b3":           b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+		"baggage":      propagation.Baggage{},
+		"tracecontext": propagation.TraceContext{},
+		"ottrace":      ot.OT{},
+	}
+	var props []propagation.TextMapPropagator
+	for _, name := range names {
+		if prop := propagatorsMap[name]; prop != nil {
+			props = append(props, prop)
+		}
+	}
+	if len(props) == 0 {
+		return nil, errors.New("invalid configuration: unsupported propagators. Supported options: b3,baggage,tracecontext,ottrace")
+	}
+	return propagation.NewCompositeTextMapPropagator(props...), nil
+}
@@ -0,0 +1,126 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+const defaultSamplerReloadInterval = 30 * time.Second
+
+// ReloadableSampler delegates to an inner sampler that can be replaced at runtime,
+// for example to raise the sample rate during an incident without redeploying.
+type ReloadableSampler struct {
+	inner atomic.Pointer[samplerHolder]
+}
+
+type samplerHolder struct {
+	sampler trace.Sampler
+}
+
+var _ trace.Sampler = (*ReloadableSampler)(nil)
+
+// Returns a new ReloadableSampler that initially delegates to sampler.
+func NewReloadableSampler(sampler trace.Sampler) *ReloadableSampler {
+	rs := &ReloadableSampler{}
+	rs.Update(sampler)
+	return rs
+}
+
+// WithReloadableSampler() sets the sampler used to sample trace spans to a ReloadableSampler.
+// Keep a reference to the sampler to change its configuration later. Like the other Honeycomb
+// samplers, it replaces a sampler set with WithSampler() whichever option is applied last.
+func WithReloadableSampler(sampler *ReloadableSampler) otelconfig.Option {
+	return withFinalSampler(sampler)
+}
+
+// Update atomically replaces the inner sampler. Spans started after Update returns
+// use the new sampler, including the SampleRate attribute it records.
+func (rs *ReloadableSampler) Update(sampler trace.Sampler) {
+	rs.inner.Store(&samplerHolder{sampler: sampler})
+}
+
+// SetSampleRate replaces the inner sampler with a DeterministicSampler using sampleRate.
+func (rs *ReloadableSampler) SetSampleRate(sampleRate int) {
+	rs.Update(NewDeterministicSampler(sampleRate))
+}
+
+// Sampler returns the current inner sampler.
+func (rs *ReloadableSampler) Sampler() trace.Sampler {
+	return rs.inner.Load().sampler
+}
+
+// WatchFile polls path every interval and, when the file's size or modification time changes,
+// replaces the inner sampler with the result of load. If load fails the current sampler is kept
+// and the error is passed to onError, which may be nil. The returned function stops watching.
+func (rs *ReloadableSampler) WatchFile(path string, interval time.Duration, load func(path string) (trace.Sampler, error), onError func(error)) (stop func()) {
+	if interval <= 0 {
+		interval = defaultSamplerReloadInterval
+	}
+	lastModTime, lastSize := statFile(path)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				modTime, size := statFile(path)
+				if modTime.Equal(lastModTime) && size == lastSize {
+					continue
+				}
+				lastModTime, lastSize = modTime, size
+				sampler, err := load(path)
+				if err != nil {
+					if onError != nil {
+						onError(err)
+					}
+					continue
+				}
+				rs.Update(sampler)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (rs *ReloadableSampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
+	return rs.Sampler().ShouldSample(parameters)
+}
+
+func (rs *ReloadableSampler) Description() string {
+	return fmt.Sprintf("ReloadableSampler{%s}", rs.Sampler().Description())
+}
+
+func statFile(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
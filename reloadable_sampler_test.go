@@ -0,0 +1,84 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestReloadableSamplerSwapsInnerSampler(t *testing.T) {
+	sampler := NewReloadableSampler(NewDeterministicSampler(0))
+	assert.Equal(t, "ReloadableSampler{DeterministicSampler}", sampler.Description())
+	assert.Equal(t, trace.Drop, sampler.ShouldSample(trace.SamplingParameters{}).Decision)
+
+	sampler.SetSampleRate(1)
+	result := sampler.ShouldSample(trace.SamplingParameters{})
+	assert.Equal(t, trace.RecordAndSample, result.Decision)
+	attr := getAttributeWithKey(result.Attributes, "SampleRate")
+	if attr == nil {
+		t.Fatalf("SampleRate attribute was not found")
+	}
+	assert.Equal(t, int64(1), attr.Value.AsInt64())
+
+	sampler.Update(trace.NeverSample())
+	assert.Equal(t, "ReloadableSampler{AlwaysOffSampler}", sampler.Description())
+}
+
+func TestReloadableSamplerWatchesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{name: all, drop: true}]\n"), 0o600))
+
+	load := func(path string) (trace.Sampler, error) {
+		return NewRulesBasedSamplerFromFile(path, 1)
+	}
+	initial, err := load(path)
+	require.NoError(t, err)
+
+	sampler := NewReloadableSampler(initial)
+	stop := sampler.WatchFile(path, 10*time.Millisecond, load, nil)
+	defer func() { stop() }()
+	assert.Equal(t, trace.Drop, sampler.ShouldSample(trace.SamplingParameters{}).Decision)
+
+	// the rules file now keeps everything
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{name: all, sample_rate: 1}]\n"), 0o600))
+	require.Eventually(t, func() bool {
+		return sampler.ShouldSample(trace.SamplingParameters{}).Decision == trace.RecordAndSample
+	}, time.Second, 10*time.Millisecond)
+
+	// an invalid file keeps the current sampler
+	errs := make(chan error, 1)
+	stop()
+	stop = sampler.WatchFile(path, 10*time.Millisecond, load, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{name: broken, conditions: [{operator: nope}]}]\n"), 0o600))
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("expected a reload error")
+	}
+	assert.Equal(t, trace.RecordAndSample, sampler.ShouldSample(trace.SamplingParameters{}).Decision)
+}
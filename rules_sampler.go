@@ -0,0 +1,264 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// Operators supported by a RuleCondition.
+const (
+	RuleOperatorEquals   = "equals"
+	RuleOperatorContains = "contains"
+	RuleOperatorRegex    = "regex"
+	RuleOperatorExists   = "exists"
+)
+
+// SamplingRulesConfig is the format of a sampling rules file.
+type SamplingRulesConfig struct {
+	// DefaultSampleRate is used for spans that match none of the rules.
+	DefaultSampleRate int            `json:"default_sample_rate" yaml:"default_sample_rate"`
+	Rules             []SamplingRule `json:"rules" yaml:"rules"`
+}
+
+// SamplingRule applies SampleRate to spans matching all of its criteria.
+type SamplingRule struct {
+	Name string `json:"name" yaml:"name"`
+	// SampleRate keeps 1 in SampleRate matching spans. It must be at least 1 unless Drop is set.
+	SampleRate int `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty"`
+	// Drop drops every matching span, instead of sampling them.
+	Drop bool `json:"drop,omitempty" yaml:"drop,omitempty"`
+	// SpanName, if set, must equal the span's name.
+	SpanName string `json:"span_name,omitempty" yaml:"span_name,omitempty"`
+	// SpanKind, if set, must equal the span's kind, e.g. "server" or "client".
+	SpanKind   string          `json:"span_kind,omitempty" yaml:"span_kind,omitempty"`
+	Conditions []RuleCondition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// RuleCondition matches a span attribute present when the span starts.
+type RuleCondition struct {
+	Attribute string `json:"attribute" yaml:"attribute"`
+	Operator  string `json:"operator" yaml:"operator"`
+	// Value is compared against the attribute's string form. It is ignored by the exists operator.
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+type compiledRule struct {
+	rule       SamplingRule
+	spanKind   oteltrace.SpanKind
+	conditions []compiledCondition
+	sampler    DeterministicSampler
+}
+
+type compiledCondition struct {
+	condition RuleCondition
+	regex     *regexp.Regexp
+}
+
+// samplerRuleAttributeKey is the attribute a RulesBasedSampler adds to the spans it samples by
+// rule, set to the name of the rule, so that the rule behind each decision can be seen.
+const samplerRuleAttributeKey = attribute.Key("honeycomb.sampler.rule")
+
+// RulesBasedSampler samples spans using the sample rate of the first rule they match,
+// falling back to a DeterministicSampler using the default sample rate. Spans matching a rule
+// have the rule's name in their honeycomb.sampler.rule attribute.
+type RulesBasedSampler struct {
+	rules          []compiledRule
+	defaultSampler DeterministicSampler
+}
+
+var _ trace.Sampler = (*RulesBasedSampler)(nil)
+
+// Returns a new RulesBasedSampler.
+//
+// Rules are evaluated in order and the first match wins. An error is returned if a rule has a
+// sample rate below 1 without setting Drop, so that a rule missing its sample rate doesn't drop
+// everything it matches, or uses an unknown operator or span kind, or an invalid regular expression.
+func NewRulesBasedSampler(rules []SamplingRule, defaultSampleRate int) (*RulesBasedSampler, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		sampleRate := rule.SampleRate
+		switch {
+		case rule.Drop && sampleRate != 0:
+			return nil, fmt.Errorf("rule %d (%s): sets both drop and sample_rate", i, rule.Name)
+		case rule.Drop:
+			sampleRate = 0
+		case sampleRate < 1:
+			return nil, fmt.Errorf("rule %d (%s): sample_rate must be at least 1, or set drop to drop matching spans", i, rule.Name)
+		}
+		c := compiledRule{
+			rule:    rule,
+			sampler: NewDeterministicSampler(sampleRate),
+		}
+		if rule.SpanKind != "" {
+			kind := spanKindFromString(rule.SpanKind)
+			if kind == oteltrace.SpanKindUnspecified {
+				return nil, fmt.Errorf("rule %d (%s): unknown span kind %q", i, rule.Name, rule.SpanKind)
+			}
+			c.spanKind = kind
+		}
+		for _, condition := range rule.Conditions {
+			cc := compiledCondition{condition: condition}
+			switch condition.Operator {
+			case RuleOperatorEquals, RuleOperatorContains, RuleOperatorExists:
+			case RuleOperatorRegex:
+				regex, err := regexp.Compile(condition.Value)
+				if err != nil {
+					return nil, fmt.Errorf("rule %d (%s): invalid regex for %s: %w", i, rule.Name, condition.Attribute, err)
+				}
+				cc.regex = regex
+			default:
+				return nil, fmt.Errorf("rule %d (%s): unknown operator %q", i, rule.Name, condition.Operator)
+			}
+			c.conditions = append(c.conditions, cc)
+		}
+		compiled = append(compiled, c)
+	}
+	return &RulesBasedSampler{
+		rules:          compiled,
+		defaultSampler: NewDeterministicSampler(defaultSampleRate),
+	}, nil
+}
+
+// Returns a new RulesBasedSampler configured from a sampling rules file.
+//
+// Files ending in .json are parsed as JSON, all others as YAML. If the file does not set
+// default_sample_rate, defaultSampleRate is used.
+func NewRulesBasedSamplerFromFile(path string, defaultSampleRate int) (*RulesBasedSampler, error) {
+	config, err := LoadSamplingRules(path)
+	if err != nil {
+		return nil, err
+	}
+	if config.DefaultSampleRate < 0 {
+		return nil, fmt.Errorf("default_sample_rate must be at least 1, or 0 or unset to use the default sample rate")
+	}
+	if config.DefaultSampleRate == 0 {
+		config.DefaultSampleRate = defaultSampleRate
+	}
+	return NewRulesBasedSampler(config.Rules, config.DefaultSampleRate)
+}
+
+// LoadSamplingRules reads a sampling rules file.
+func LoadSamplingRules(path string) (SamplingRulesConfig, error) {
+	var config SamplingRulesConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("unable to read sampling rules file: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &config)
+	} else {
+		err = yaml.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return config, fmt.Errorf("unable to parse sampling rules file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+func (rs *RulesBasedSampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
+	for _, rule := range rs.rules {
+		if rule.matches(parameters) {
+			result := rule.sampler.ShouldSample(parameters)
+			result.Attributes = append(result.Attributes, samplerRuleAttributeKey.String(rule.rule.Name))
+			return result
+		}
+	}
+	return rs.defaultSampler.ShouldSample(parameters)
+}
+
+// droppedByRule reports whether result is a RulesBasedSampler dropping a span because it matched
+// a rule that sets Drop, rather than one sampled out at the rule's sample rate.
+func droppedByRule(result trace.SamplingResult) bool {
+	if result.Decision != trace.Drop {
+		return false
+	}
+	matched, sampleRate := false, int64(-1)
+	for _, attr := range result.Attributes {
+		switch attr.Key {
+		case samplerRuleAttributeKey:
+			matched = true
+		case sampleRateAttributeKey:
+			sampleRate = attr.Value.AsInt64()
+		}
+	}
+	return matched && sampleRate == 0
+}
+
+func (rs *RulesBasedSampler) Description() string {
+	return "RulesBasedSampler"
+}
+
+func (r compiledRule) matches(parameters trace.SamplingParameters) bool {
+	if r.rule.SpanName != "" && r.rule.SpanName != parameters.Name {
+		return false
+	}
+	if r.spanKind != oteltrace.SpanKindUnspecified && r.spanKind != parameters.Kind {
+		return false
+	}
+	for _, condition := range r.conditions {
+		if !condition.matches(parameters.Attributes) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c compiledCondition) matches(attrs []attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if string(attr.Key) != c.condition.Attribute {
+			continue
+		}
+		value := attr.Value.Emit()
+		switch c.condition.Operator {
+		case RuleOperatorExists:
+			return true
+		case RuleOperatorEquals:
+			return value == c.condition.Value
+		case RuleOperatorContains:
+			return strings.Contains(value, c.condition.Value)
+		case RuleOperatorRegex:
+			return c.regex.MatchString(value)
+		}
+	}
+	return false
+}
+
+func spanKindFromString(kind string) oteltrace.SpanKind {
+	switch strings.ToLower(kind) {
+	case "internal":
+		return oteltrace.SpanKindInternal
+	case "server":
+		return oteltrace.SpanKindServer
+	case "client":
+		return oteltrace.SpanKindClient
+	case "producer":
+		return oteltrace.SpanKindProducer
+	case "consumer":
+		return oteltrace.SpanKindConsumer
+	default:
+		return oteltrace.SpanKindUnspecified
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestRulesBasedSamplerAppliesFirstMatchingRule(t *testing.T) {
+	sampler, err := NewRulesBasedSampler([]SamplingRule{
+		{Name: "health checks", Drop: true, SpanName: "GET /healthz"},
+		{Name: "errors", SampleRate: 1, Conditions: []RuleCondition{
+			{Attribute: "http.status_code", Operator: RuleOperatorRegex, Value: "^5"},
+		}},
+		{Name: "admin", SampleRate: 1, SpanKind: "server", Conditions: []RuleCondition{
+			{Attribute: "http.route", Operator: RuleOperatorContains, Value: "/admin"},
+			{Attribute: "user.id", Operator: RuleOperatorExists},
+		}},
+		{Name: "checkout", SampleRate: 1, Conditions: []RuleCondition{
+			{Attribute: "http.route", Operator: RuleOperatorEquals, Value: "/checkout"},
+		}},
+	}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "RulesBasedSampler", sampler.Description())
+
+	testCases := []struct {
+		desc       string
+		parameters trace.SamplingParameters
+		decision   trace.SamplingDecision
+	}{
+		{
+			desc:       "span name",
+			parameters: trace.SamplingParameters{Name: "GET /healthz"},
+			decision:   trace.Drop,
+		},
+		{
+			desc: "regex",
+			parameters: trace.SamplingParameters{Attributes: []attribute.KeyValue{
+				attribute.Int("http.status_code", 503),
+			}},
+			decision: trace.RecordAndSample,
+		},
+		{
+			desc: "all conditions and span kind match",
+			parameters: trace.SamplingParameters{Kind: oteltrace.SpanKindServer, Attributes: []attribute.KeyValue{
+				attribute.String("http.route", "/admin/users"),
+				attribute.String("user.id", "123"),
+			}},
+			decision: trace.RecordAndSample,
+		},
+		{
+			desc: "span kind does not match",
+			parameters: trace.SamplingParameters{Kind: oteltrace.SpanKindClient, Attributes: []attribute.KeyValue{
+				attribute.String("http.route", "/admin/users"),
+				attribute.String("user.id", "123"),
+			}},
+			decision: trace.Drop,
+		},
+		{
+			desc: "equals",
+			parameters: trace.SamplingParameters{Attributes: []attribute.KeyValue{
+				attribute.String("http.route", "/checkout"),
+			}},
+			decision: trace.RecordAndSample,
+		},
+		{
+			desc:       "falls back to default",
+			parameters: trace.SamplingParameters{Name: "something else"},
+			decision:   trace.Drop,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			result := sampler.ShouldSample(tC.parameters)
+			assert.Equal(t, tC.decision, result.Decision)
+			if tC.decision == trace.RecordAndSample {
+				attr := getAttributeWithKey(result.Attributes, "SampleRate")
+				if attr == nil {
+					t.Fatalf("SampleRate attribute was not found")
+				}
+				assert.Equal(t, int64(1), attr.Value.AsInt64())
+			}
+		})
+	}
+}
+
+func TestRulesBasedSamplerRejectsInvalidRules(t *testing.T) {
+	_, err := NewRulesBasedSampler([]SamplingRule{
+		{Name: "bad regex", SampleRate: 1, Conditions: []RuleCondition{{Attribute: "a", Operator: RuleOperatorRegex, Value: "("}}},
+	}, 1)
+	assert.Error(t, err)
+
+	_, err = NewRulesBasedSampler([]SamplingRule{
+		{Name: "bad operator", SampleRate: 1, Conditions: []RuleCondition{{Attribute: "a", Operator: "startswith"}}},
+	}, 1)
+	assert.Error(t, err)
+
+	_, err = NewRulesBasedSampler([]SamplingRule{{Name: "bad kind", SampleRate: 1, SpanKind: "sideways"}}, 1)
+	assert.Error(t, err)
+
+	_, err = NewRulesBasedSampler([]SamplingRule{{Name: "missing sample rate", SpanName: "GET /"}}, 1)
+	assert.ErrorContains(t, err, "sample_rate must be at least 1")
+
+	_, err = NewRulesBasedSampler([]SamplingRule{{Name: "negative sample rate", SampleRate: -1}}, 1)
+	assert.ErrorContains(t, err, "sample_rate must be at least 1")
+
+	_, err = NewRulesBasedSampler([]SamplingRule{{Name: "drop and sample", Drop: true, SampleRate: 10}}, 1)
+	assert.ErrorContains(t, err, "sets both drop and sample_rate")
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("default_sample_rate: -1\n"), 0o600))
+	_, err = NewRulesBasedSamplerFromFile(path, 1)
+	assert.ErrorContains(t, err, "default_sample_rate must be at least 1, or 0 or unset to use the default sample rate")
+	require.NoError(t, os.WriteFile(path, []byte("default_sample_rate: 0\n"), 0o600))
+	_, err = NewRulesBasedSamplerFromFile(path, 1)
+	assert.NoError(t, err)
+}
+
+func TestRulesFileMissingSampleRateIsReported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - name: typo\n    sampel_rate: 10\n    span_name: GET /\n"), 0o600))
+	config := freshConfig()
+	WithStrictValidation()(config)
+	WithApiKey("123456789012345678901")(config)
+	withRulesBasedSamplerFile(path, 1, 0)(config)
+
+	err := validateConfig(config)
+	assert.ErrorContains(t, err, "sample_rate must be at least 1")
+	assert.Equal(t, trace.RecordAndSample, config.Sampler.ShouldSample(trace.SamplingParameters{Name: "GET /"}).Decision)
+}
+
+func TestLoadSamplingRulesFromYAMLAndJSON(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`
+default_sample_rate: 10
+rules:
+  - name: health checks
+    sample_rate: 1000
+    span_name: GET /healthz
+  - name: errors
+    sample_rate: 1
+    conditions:
+      - attribute: http.status_code
+        operator: regex
+        value: "^5"
+`), 0o600))
+	jsonPath := filepath.Join(dir, "rules.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{
+  "default_sample_rate": 10,
+  "rules": [
+    {"name": "health checks", "sample_rate": 1000, "span_name": "GET /healthz"},
+    {"name": "errors", "sample_rate": 1, "conditions": [
+      {"attribute": "http.status_code", "operator": "regex", "value": "^5"}
+    ]}
+  ]
+}`), 0o600))
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		config, err := LoadSamplingRules(path)
+		require.NoError(t, err)
+		assert.Equal(t, 10, config.DefaultSampleRate)
+		assert.Equal(t, 2, len(config.Rules))
+		assert.Equal(t, "GET /healthz", config.Rules[0].SpanName)
+		assert.Equal(t, RuleOperatorRegex, config.Rules[1].Conditions[0].Operator)
+	}
+}
+
+func TestConfigureRulesBasedSamplerFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - name: all\n    sample_rate: 1\n"), 0o600))
+	t.Setenv("HONEYCOMB_SAMPLER_RULES_FILE", path)
+
+	config := freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	takeConfigState(config).applySamplers(config)
+	assert.Equal(t, "ReloadableSampler{RulesBasedSampler}", config.Sampler.Description())
+
+	// reloading can be disabled
+	t.Setenv("HONEYCOMB_SAMPLER_RELOAD_INTERVAL", "0")
+	config = freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	// the rules take precedence over samplers set by other options
+	WithSampler(10)(config)
+	takeConfigState(config).applySamplers(config)
+	assert.Equal(t, "RulesBasedSampler", config.Sampler.Description())
+
+	// a missing file is reported and SAMPLE_RATE is used instead
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	t.Setenv("HONEYCOMB_SAMPLER_RULES_FILE", missing)
+	t.Setenv("SAMPLE_RATE", "5")
+	t.Setenv("HONEYCOMB_API_KEY", "123456789012345678901")
+	config = freshConfig()
+	logger := &captureLogger{}
+	config.Logger = logger
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, "DeterministicSampler", config.Sampler.Description())
+	assert.Equal(t, samplerRulesFileInvalidMessage, logger.Format)
+	assert.Equal(t, missing, logger.Values[0])
+
+	// or returned with strict validation
+	t.Setenv("HONEYCOMB_STRICT_CONFIG", "true")
+	config = freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	assert.ErrorContains(t, validateConfig(config), "HONEYCOMB_SAMPLER_RULES_FILE can't be used")
+}
+
+func TestRulesFileIsOnlyWatchedOnceConfigured(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - name: all\n    sample_rate: 1\n"), 0o600))
+	config := freshConfig()
+	withRulesBasedSamplerFile(path, 1, 10*time.Millisecond)(config)
+	reloadable := stateFor(config).sampler.(*ReloadableSampler)
+
+	// nothing is watched if validation fails
+	WithStrictValidation()(config)
+	require.Error(t, validateConfig(config))
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - name: none\n    sample_rate: 100\n"), 0o600))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "RulesBasedSampler", reloadable.Sampler().Description())
+	assert.Equal(t, 1, reloadable.Sampler().(*RulesBasedSampler).rules[0].rule.SampleRate)
+
+	// once validated, changes are picked up until shut down
+	config = freshConfig()
+	WithApiKey("123456789012345678901")(config)
+	withRulesBasedSamplerFile(path, 1, 10*time.Millisecond)(config)
+	reloadable = stateFor(config).sampler.(*ReloadableSampler)
+	require.NoError(t, validateConfig(config))
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - name: some\n    sample_rate: 10\n    span_name: other\n"), 0o600))
+	require.Eventually(t, func() bool {
+		return reloadable.Sampler().(*RulesBasedSampler).rules[0].rule.SampleRate == 10
+	}, time.Second, 10*time.Millisecond)
+	for _, shutdown := range config.ShutdownFunctions {
+		require.NoError(t, shutdown(config))
+	}
+}
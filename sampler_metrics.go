@@ -0,0 +1,120 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"math"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// instrumentedSampler counts the sampling decisions made by another sampler and,
+// when a logger is set, logs each decision.
+type instrumentedSampler struct {
+	inner     trace.Sampler
+	logger    otelconfig.Logger
+	decisions metric.Int64Counter
+}
+
+var _ trace.Sampler = (*instrumentedSampler)(nil)
+
+// instrumentSampler wraps the sampler in c, unless it already is, so that its decisions are
+// counted when metrics are enabled and logged when debugging. It is left as is otherwise.
+func instrumentSampler(c *otelconfig.Config) {
+	if _, instrumented := c.Sampler.(*instrumentedSampler); c.Sampler == nil || instrumented {
+		return
+	}
+	var logger otelconfig.Logger
+	if c.LogLevel == "debug" {
+		logger = c.Logger
+	}
+	if !c.MetricsEnabled && logger == nil {
+		return
+	}
+	c.Sampler = newInstrumentedSampler(c.Sampler, logger)
+}
+
+// newInstrumentedSampler wraps sampler so that its decisions are counted using the global
+// OpenTelemetry meter provider, in the honeycomb.sampler.decisions counter. Decisions are
+// broken down by sampler, decision (kept, recorded or dropped), sample rate, rounded up to a
+// power of ten to keep the number of series bounded for samplers that adjust their rates, and,
+// for the RulesBasedSampler, the matching rule. If logger is not nil each decision is also logged.
+func newInstrumentedSampler(sampler trace.Sampler, logger otelconfig.Logger) *instrumentedSampler {
+	decisions, _ := otel.Meter(instrumentationName).Int64Counter("honeycomb.sampler.decisions",
+		metric.WithDescription("Sampling decisions made for trace spans"))
+	return &instrumentedSampler{
+		inner:     sampler,
+		logger:    logger,
+		decisions: decisions,
+	}
+}
+
+func (s *instrumentedSampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
+	result := s.inner.ShouldSample(parameters)
+
+	decision := "dropped"
+	switch result.Decision {
+	case trace.RecordAndSample:
+		decision = "kept"
+	case trace.RecordOnly:
+		decision = "recorded"
+	}
+	sampleRate := int64(0)
+	var rule string
+	for _, attr := range result.Attributes {
+		switch attr.Key {
+		case sampleRateAttributeKey:
+			sampleRate = attr.Value.AsInt64()
+		case samplerRuleAttributeKey:
+			rule = attr.Value.AsString()
+		}
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("sampler", s.inner.Description()),
+		attribute.String("decision", decision),
+	}
+	if sampleRate > 0 {
+		attrs = append(attrs, attribute.Int64("sample_rate", sampleRateBucket(sampleRate)))
+	}
+	if rule != "" {
+		attrs = append(attrs, attribute.String("rule", rule))
+	}
+	s.decisions.Add(context.Background(), 1, metric.WithAttributes(attrs...))
+
+	if s.logger != nil {
+		s.logger.Debugf("sampler %s %s span %q (trace %s, SampleRate %d, rule %q)",
+			s.inner.Description(), decision, parameters.Name, parameters.TraceID, sampleRate, rule)
+	}
+	return result
+}
+
+func (s *instrumentedSampler) Description() string {
+	return s.inner.Description()
+}
+
+// sampleRateBucket rounds rate up to a power of ten.
+func sampleRateBucket(rate int64) int64 {
+	bucket := int64(1)
+	for bucket < rate && bucket <= math.MaxInt64/10 {
+		bucket *= 10
+	}
+	return bucket
+}
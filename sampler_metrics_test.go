@@ -0,0 +1,164 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func useManualMeterReader(t *testing.T) *sdkmetric.ManualReader {
+	previous := otel.GetMeterProvider()
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	return reader
+}
+
+func sumDataPoints(t *testing.T, reader *sdkmetric.ManualReader, name string) []metricdata.DataPoint[int64] {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data.(metricdata.Sum[int64]).DataPoints
+			}
+		}
+	}
+	return nil
+}
+
+func TestInstrumentedSamplerCountsDecisions(t *testing.T) {
+	reader := useManualMeterReader(t)
+
+	inner, err := NewRulesBasedSampler([]SamplingRule{
+		{Name: "drop health checks", Drop: true, SpanName: "GET /healthz"},
+	}, 1)
+	require.NoError(t, err)
+	logger := &captureLogger{}
+	sampler := newInstrumentedSampler(inner, logger)
+	assert.Equal(t, "RulesBasedSampler", sampler.Description())
+
+	result := sampler.ShouldSample(trace.SamplingParameters{Name: "GET /healthz"})
+	assert.Equal(t, "drop health checks", getAttributeWithKey(result.Attributes, "honeycomb.sampler.rule").Value.AsString())
+	sampler.ShouldSample(trace.SamplingParameters{Name: "GET /healthz"})
+	sampler.ShouldSample(trace.SamplingParameters{Name: "GET /"})
+	assert.Equal(t, "sampler %s %s span %q (trace %s, SampleRate %d, rule %q)", logger.Format)
+	assert.Equal(t, "kept", logger.Values[1])
+
+	points := sumDataPoints(t, reader, "honeycomb.sampler.decisions")
+	require.Equal(t, 2, len(points))
+	counts := map[attribute.Distinct]int64{}
+	for _, point := range points {
+		counts[point.Attributes.Equivalent()] = point.Value
+	}
+	dropped := attribute.NewSet(
+		attribute.String("sampler", "RulesBasedSampler"),
+		attribute.String("decision", "dropped"),
+		attribute.String("rule", "drop health checks"),
+	)
+	kept := attribute.NewSet(
+		attribute.String("sampler", "RulesBasedSampler"),
+		attribute.String("decision", "kept"),
+		attribute.Int64("sample_rate", 1),
+	)
+	assert.Equal(t, int64(2), counts[dropped.Equivalent()])
+	assert.Equal(t, int64(1), counts[kept.Equivalent()])
+}
+
+func TestInstrumentedSamplerBucketsSampleRates(t *testing.T) {
+	reader := useManualMeterReader(t)
+
+	sampler := newInstrumentedSampler(trace.AlwaysSample(), nil)
+	for _, rate := range []int{37, 42, 100, 101} {
+		sampler.inner = NewDeterministicSampler(rate)
+		sampler.ShouldSample(trace.SamplingParameters{TraceID: [16]byte{1}})
+	}
+
+	rates := map[int64]int64{}
+	for _, point := range sumDataPoints(t, reader, "honeycomb.sampler.decisions") {
+		rate, ok := point.Attributes.Value("sample_rate")
+		require.True(t, ok)
+		rates[rate.AsInt64()] += point.Value
+	}
+	assert.Equal(t, map[int64]int64{100: 3, 1000: 1}, rates)
+}
+
+func TestInstrumentedSamplerCountsDroppedSpansWithTheirSampleRate(t *testing.T) {
+	reader := useManualMeterReader(t)
+
+	sampler := newInstrumentedSampler(NewDeterministicSampler(10), nil)
+	result := sampler.ShouldSample(trace.SamplingParameters{TraceID: oteltrace.TraceID{8: 0xff}})
+	require.Equal(t, trace.Drop, result.Decision)
+
+	points := sumDataPoints(t, reader, "honeycomb.sampler.decisions")
+	require.Equal(t, 1, len(points))
+	dropped := attribute.NewSet(
+		attribute.String("sampler", "DeterministicSampler"),
+		attribute.String("decision", "dropped"),
+		attribute.Int64("sample_rate", 10),
+	)
+	assert.Equal(t, dropped, points[0].Attributes)
+}
+
+func TestValidateConfigInstrumentsSampler(t *testing.T) {
+	config := freshConfig()
+	config.Sampler = NewDeterministicSampler(1)
+	require.NoError(t, validateConfig(config))
+	assert.IsType(t, DeterministicSampler{}, config.Sampler, "not instrumented without metrics or debug logging")
+
+	config = freshConfig()
+	config.MetricsEnabled = true
+	config.Sampler = NewDeterministicSampler(1)
+	require.NoError(t, validateConfig(config))
+	sampler, ok := config.Sampler.(*instrumentedSampler)
+	require.True(t, ok)
+	assert.Nil(t, sampler.logger)
+	assert.Equal(t, "DeterministicSampler", config.Sampler.Description())
+
+	// validating again doesn't wrap the sampler twice
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, sampler, config.Sampler)
+
+	// decisions are logged when debugging
+	config = freshConfig()
+	config.LogLevel = "debug"
+	config.Logger = &captureLogger{}
+	require.NoError(t, validateConfig(config))
+	assert.NotNil(t, config.Sampler.(*instrumentedSampler).logger)
+}
+
+func TestSamplerIsInstrumentedBeforeErrorBias(t *testing.T) {
+	config := freshConfig()
+	config.MetricsEnabled = true
+	WithErrorBiasedSampling()(config)
+	WithSampler(10)(config)
+	takeConfigState(config).applySamplers(config)
+
+	// decisions are counted as the configured sampler makes them, not as recorded for error bias
+	sampler, ok := config.Sampler.(errorBiasedSampler)
+	require.True(t, ok)
+	assert.IsType(t, &instrumentedSampler{}, sampler.inner)
+}
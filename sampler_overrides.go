@@ -0,0 +1,123 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+const httpRouteAttributeKey = "http.route"
+
+// overrideSampler applies per span name or per route sample rates, falling back to another sampler.
+type overrideSampler struct {
+	overrides []samplerOverride
+	fallback  trace.Sampler
+}
+
+type samplerOverride struct {
+	pattern string
+	regex   *regexp.Regexp
+	sampler DeterministicSampler
+}
+
+var _ trace.Sampler = overrideSampler{}
+
+// WithSamplerOverrides() sets sample rates for spans whose name or http.route attribute matches
+// a key of overrides, falling back to the currently configured sampler for other spans.
+//
+// Keys may use the glob wildcards "*", matching any sequence of characters, and "?", matching a
+// single character. Keys without wildcards take precedence, followed by wildcard keys in order of
+// decreasing length. For example, {"GET /healthz": 1000, "/checkout*": 1} samples health checks
+// at 1/1000 and keeps every checkout request. The overrides wrap the final sampler, whichever
+// option sets it and in whatever order the options are applied.
+func WithSamplerOverrides(overrides map[string]int) otelconfig.Option {
+	return withSamplerWrapper(func(sampler trace.Sampler) trace.Sampler {
+		return newOverrideSampler(overrides, sampler)
+	})
+}
+
+func newOverrideSampler(overrides map[string]int, fallback trace.Sampler) overrideSampler {
+	compiled := make([]samplerOverride, 0, len(overrides))
+	for pattern, rate := range overrides {
+		compiled = append(compiled, samplerOverride{
+			pattern: pattern,
+			regex:   globToRegexp(pattern),
+			sampler: NewDeterministicSampler(rate),
+		})
+	}
+	sort.Slice(compiled, func(i, j int) bool {
+		a, b := compiled[i].pattern, compiled[j].pattern
+		if isGlob(a) != isGlob(b) {
+			return !isGlob(a)
+		}
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+	return overrideSampler{
+		overrides: compiled,
+		fallback:  fallback,
+	}
+}
+
+func (s overrideSampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
+	route := ""
+	for _, attr := range parameters.Attributes {
+		if string(attr.Key) == httpRouteAttributeKey {
+			route = attr.Value.Emit()
+			break
+		}
+	}
+	for _, override := range s.overrides {
+		if override.regex.MatchString(parameters.Name) || (route != "" && override.regex.MatchString(route)) {
+			return override.sampler.ShouldSample(parameters)
+		}
+	}
+	return s.fallback.ShouldSample(parameters)
+}
+
+func (s overrideSampler) Description() string {
+	return fmt.Sprintf("OverrideSampler{%s}", s.fallback.Description())
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?")
+}
+
+// globToRegexp compiles a glob pattern, where "*" matches any sequence of characters
+// (including "/") and "?" matches a single character, to an anchored regular expression.
+func globToRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
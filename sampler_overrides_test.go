@@ -0,0 +1,117 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestSamplerOverrides(t *testing.T) {
+	config := freshConfig()
+	WithSampler(1)(config)
+	WithSamplerOverrides(map[string]int{
+		"GET /healthz":    0,
+		"/checkout*":      1,
+		"/api/*":          0,
+		"/api/v?/orders*": 1,
+		"/api/v1/orders":  0,
+	})(config)
+	takeConfigState(config).applySamplers(config)
+	assert.Equal(t, "OverrideSampler{DeterministicSampler}", config.Sampler.Description())
+
+	testCases := []struct {
+		desc       string
+		name       string
+		route      string
+		decision   trace.SamplingDecision
+		sampleRate int64
+	}{
+		{desc: "exact span name", name: "GET /healthz", decision: trace.Drop},
+		{desc: "glob route", name: "POST", route: "/checkout/confirm", decision: trace.RecordAndSample, sampleRate: 1},
+		{desc: "exact route wins over globs", name: "GET", route: "/api/v1/orders", decision: trace.Drop},
+		{desc: "longer glob wins", name: "GET", route: "/api/v2/orders/123", decision: trace.RecordAndSample, sampleRate: 1},
+		{desc: "shorter glob", name: "GET", route: "/api/v2/users", decision: trace.Drop},
+		{desc: "falls back to global rate", name: "GET /", route: "/", decision: trace.RecordAndSample, sampleRate: 1},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			parameters := trace.SamplingParameters{Name: tC.name}
+			if tC.route != "" {
+				parameters.Attributes = []attribute.KeyValue{attribute.String("http.route", tC.route)}
+			}
+			result := config.Sampler.ShouldSample(parameters)
+			assert.Equal(t, tC.decision, result.Decision)
+			if tC.decision == trace.RecordAndSample {
+				attr := getAttributeWithKey(result.Attributes, "SampleRate")
+				if attr == nil {
+					t.Fatalf("SampleRate attribute was not found")
+				}
+				assert.Equal(t, tC.sampleRate, attr.Value.AsInt64())
+			}
+		})
+	}
+}
+
+func TestSamplerOverridesSampleHealthChecksAtTheirRate(t *testing.T) {
+	config := freshConfig()
+	WithSampler(1)(config)
+	WithSamplerOverrides(map[string]int{"GET /healthz": 1000})(config)
+	takeConfigState(config).applySamplers(config)
+
+	random := rand.New(rand.NewSource(1))
+	const spans = 200000
+	sampled := 0
+	for i := 0; i < spans; i++ {
+		var traceID oteltrace.TraceID
+		random.Read(traceID[:])
+		result := config.Sampler.ShouldSample(trace.SamplingParameters{TraceID: traceID, Name: "GET /healthz"})
+		if result.Decision != trace.RecordAndSample {
+			continue
+		}
+		sampled++
+		attr := getAttributeWithKey(result.Attributes, "SampleRate")
+		if attr == nil {
+			t.Fatalf("SampleRate attribute was not found")
+		}
+		assert.Equal(t, int64(1000), attr.Value.AsInt64())
+	}
+	// about 1 in 1000 health checks are kept, each standing in for 1000
+	assert.InDelta(t, spans/1000, sampled, 60)
+}
+
+func TestSamplerOverridesWrapSamplerSetAfterThem(t *testing.T) {
+	config := freshConfig()
+	WithSamplerOverrides(map[string]int{"GET /healthz": 1000})(config)
+	WithSampler(5)(config)
+	takeConfigState(config).applySamplers(config)
+	assert.Equal(t, "OverrideSampler{DeterministicSampler}", config.Sampler.Description())
+
+	result := config.Sampler.ShouldSample(trace.SamplingParameters{Name: "GET /"})
+	assert.Equal(t, int64(5), getAttributeWithKey(result.Attributes, "SampleRate").Value.AsInt64())
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	assert.True(t, globToRegexp("/users/*").MatchString("/users/1/orders"))
+	assert.True(t, globToRegexp("GET /v?").MatchString("GET /v1"))
+	assert.False(t, globToRegexp("GET /v?").MatchString("GET /v12"))
+	assert.True(t, globToRegexp("a.b").MatchString("a.b"))
+	assert.False(t, globToRegexp("a.b").MatchString("axb"))
+}
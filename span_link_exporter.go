@@ -15,65 +15,205 @@
 package honeycomb
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 
+	"github.com/honeycombio/otel-config-go/otelconfig"
 	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
+const (
+	defaultUIBaseUrl       = "https://ui.honeycomb.io"
+	placeholderTeam        = "your-team"
+	placeholderEnvironment = "your-environment"
+)
+
+// maxErrorFocusTraces limits the number of traces the span link exporter remembers errored spans for.
+const maxErrorFocusTraces = 1000
+
 type spanLinkExporter struct {
-	linkUrl string
+	*traceLinkResolver
+
+	mu         sync.Mutex
+	writer     io.Writer
+	logger     *slog.Logger
+	jsonLines  bool
+	errorFocus bool
+	// errored holds the first errored span of traces whose root span hasn't been exported yet.
+	errored map[oteltrace.TraceID]oteltrace.SpanID
 }
 
 var _ trace.SpanExporter = (*spanLinkExporter)(nil)
 
-func NewSpanLinkExporter(apikey string, serviceName string) (*spanLinkExporter, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://api.honeycomb.io/1/auth", nil)
-	if err != nil {
-		return nil, err
+// SpanLinkExporterOption configures where and how the span link exporter writes trace links.
+type SpanLinkExporterOption func(*spanLinkExporter)
+
+// WithSpanLinkWriter() writes trace links to w instead of stdout.
+func WithSpanLinkWriter(w io.Writer) SpanLinkExporterOption {
+	return func(e *spanLinkExporter) {
+		e.writer = w
 	}
-	req.Header.Set("X-Honeycomb-Team", apikey)
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// WithSpanLinkLogger() logs trace links as structured records using logger instead of writing them out.
+func WithSpanLinkLogger(logger *slog.Logger) SpanLinkExporterOption {
+	return func(e *spanLinkExporter) {
+		e.logger = logger
 	}
-	defer resp.Body.Close()
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalln(err)
+// WithSpanLinkJSON() writes each trace link as a line of JSON instead of human readable text.
+func WithSpanLinkJSON() SpanLinkExporterOption {
+	return func(e *spanLinkExporter) {
+		e.jsonLines = true
+	}
+}
+
+// WithSpanLinkApiEndpoint() sets the Honeycomb API endpoint used to look up the team and
+// environment for trace links, for teams outside Honeycomb's US region.
+func WithSpanLinkApiEndpoint(endpoint string) SpanLinkExporterOption {
+	return func(e *spanLinkExporter) {
+		e.apiEndpoint = endpoint
+	}
+}
+
+// WithSpanLinkErrorFocus() focuses trace links on the first span in the trace with an error
+// status or exception event, when there is one.
+func WithSpanLinkErrorFocus() SpanLinkExporterOption {
+	return func(e *spanLinkExporter) {
+		e.errorFocus = true
 	}
+}
+
+// WithUIBaseURL() sets the base URL of the Honeycomb UI used in trace links, such as
+// "https://ui.eu1.honeycomb.io". By default it is derived from the Honeycomb API endpoint.
+func WithUIBaseURL(url string) SpanLinkExporterOption {
+	return func(e *spanLinkExporter) {
+		e.uiBaseUrl = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithLocalVisualizations() writes a link to each trace in Honeycomb as its root span ends.
+// By default links are written to stdout; use options to write them elsewhere, such as to a
+// structured logger. Links are written in batches, off the goroutine that ends the span.
+// The API key, service name and, when it is a Honeycomb endpoint, exporter endpoint used for
+// links are those in effect once configuration is complete.
+func WithLocalVisualizations(options ...SpanLinkExporterOption) otelconfig.Option {
+	// a config file that can't be loaded is reported when configuring
+	settings, _ := loadConfigSettings()
+	return withLocalVisualizations(settings, options...)
+}
+
+// withLocalVisualizations() is WithLocalVisualizations() with the span link settings in settings,
+// which options take precedence over.
+func withLocalVisualizations(settings configSettings, options ...SpanLinkExporterOption) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		exporter := newSpanLinkExporter(newConfigTraceLinkResolver(c, stateFor(c)), append(spanLinkOptionsFromSettings(settings), options...)...)
+		c.SpanProcessors = append(c.SpanProcessors, trace.NewBatchSpanProcessor(exporter))
+	}
+}
+
+// spanLinkOptionsFromSettings returns the span link exporter options set in settings, from the
+// environment or a config file. The endpoint is only used to look up teams and environments when
+// it is one of Honeycomb's API hosts, since telemetry may be sent to a collector instead.
+func spanLinkOptionsFromSettings(settings configSettings) []SpanLinkExporterOption {
+	var options []SpanLinkExporterOption
+	if settings.get("HONEYCOMB_LOCAL_VISUALIZATIONS_FORMAT") == "json" {
+		options = append(options, WithSpanLinkJSON())
+	}
+	if endpoint := settings.get("HONEYCOMB_API_ENDPOINT"); isHoneycombApiHost(endpointHost(endpoint)) {
+		options = append(options, WithSpanLinkApiEndpoint(endpoint))
+	}
+	return options
+}
+
+// NewSpanLinkExporter returns an exporter that writes a link to each trace in Honeycomb when its
+// root span is exported.
+//
+// The team and environment for apikey are looked up from Honeycomb's API when the first link is
+// written, and cached on disk for later runs. If Honeycomb can't be reached, a placeholder link is
+// written instead. The error is always nil and is kept for compatibility.
+func NewSpanLinkExporter(apikey string, serviceName string, options ...SpanLinkExporterOption) (*spanLinkExporter, error) {
+	resolver := newTraceLinkResolver(func() (string, string) {
+		return apikey, serviceName
+	})
+	return newSpanLinkExporter(resolver, options...), nil
+}
 
-	var hnyAuthResp honeycombAuthResponse
-	err = json.Unmarshal(body, &hnyAuthResp)
+func newSpanLinkExporter(resolver *traceLinkResolver, options ...SpanLinkExporterOption) *spanLinkExporter {
+	exporter := &spanLinkExporter{
+		traceLinkResolver: resolver,
+		writer:            os.Stdout,
+		errored:           map[oteltrace.TraceID]oteltrace.SpanID{},
+	}
+	for _, option := range options {
+		option(exporter)
+	}
+	return exporter
+}
+
+// uiBaseUrlForApiEndpoint maps a Honeycomb API endpoint to the UI for the same region, so
+// api.eu1.honeycomb.io maps to https://ui.eu1.honeycomb.io. Other endpoints, such as a
+// collector or proxy, map to Honeycomb's US UI.
+func uiBaseUrlForApiEndpoint(endpoint string) string {
+	host := endpointHost(endpoint)
+	if !isHoneycombApiHost(host) {
+		return defaultUIBaseUrl
+	}
+	return "https://ui." + strings.TrimPrefix(host, "api.")
+}
+
+// endpointHost returns the host name of an endpoint given with or without a scheme and port.
+func endpointHost(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
 	if err != nil {
-		return nil, err
+		return ""
 	}
+	return strings.ToLower(u.Hostname())
+}
+
+// isHoneycombApiHost reports whether host is one of Honeycomb's regional API hosts.
+func isHoneycombApiHost(host string) bool {
+	return strings.HasPrefix(host, "api.") && strings.HasSuffix(host, ".honeycomb.io")
+}
+
+// traceLinkPath is appended to a dataset link to link to a trace, followed by the trace ID.
+const traceLinkPath = "/trace?trace_id"
 
-	linkUrl := buildTraceLinkUrl(isClassicApiKey(apikey), hnyAuthResp.Team.Slug, hnyAuthResp.Environment.Slug, serviceName)
-	return &spanLinkExporter{
-		linkUrl: linkUrl,
-	}, nil
+func buildTraceLinkUrl(uiBaseUrl string, isClassic bool, team string, environment string, dataset string) string {
+	return buildDatasetUrl(uiBaseUrl, isClassic, team, environment, dataset) + traceLinkPath
 }
 
-func buildTraceLinkUrl(isClassic bool, team string, environment string, dataset string) string {
-	url := fmt.Sprintf("https://ui.honeycomb.io/%s", team)
+func buildDatasetUrl(uiBaseUrl string, isClassic bool, team string, environment string, dataset string) string {
+	url := fmt.Sprintf("%s/%s", uiBaseUrl, team)
 	if !isClassic {
 		url += fmt.Sprintf("/environments/%s", environment)
 	}
-	url += fmt.Sprintf("/datasets/%s/trace?trace_id", dataset)
+	url += fmt.Sprintf("/datasets/%s", dataset)
 	return url
 }
 
 type honeycombAuthResponse struct {
-	Environment environment `json:"environment"`
-	Team        team        `json:"team"`
+	Environment  environment  `json:"environment"`
+	Team         team         `json:"team"`
+	ApiKeyAccess apiKeyAccess `json:"api_key_access"`
+}
+
+type apiKeyAccess struct {
+	// Events is whether the key can send telemetry.
+	Events bool `json:"events"`
 }
 
 type environment struct {
@@ -84,22 +224,91 @@ type team struct {
 	Slug string `json:"slug"`
 }
 
+// spanLinkRecord is a trace link written in JSON lines mode.
+type spanLinkRecord struct {
+	Name    string `json:"name"`
+	TraceID string `json:"trace_id"`
+	URL     string `json:"url"`
+}
+
 // Export spans is required to implement the Exporter interface.
 // It does not actually export spans. Instead, it builds a link to
 // honeycomb for the trace that was created, then prints it out!
+// The links for a batch of spans are written together, so they don't
+// interleave with other output.
 func (e *spanLinkExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
 	if len(spans) == 0 {
 		return nil
 	}
 
+	if e.errorFocus {
+		e.rememberErroredSpans(spans)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	linkUrl := ""
 	for _, span := range spans {
 		// if a root span (ie no parent span ID)
-		if !span.Parent().SpanID().IsValid() {
-			fmt.Printf("Trace for %s\nHoneycomb link: %s=%s\n", span.Name(), e.linkUrl, span.SpanContext().TraceID().String())
+		if span.Parent().SpanID().IsValid() {
+			continue
+		}
+		if linkUrl == "" {
+			linkUrl = e.traceLinkUrl(ctx)
+		}
+		traceID := span.SpanContext().TraceID().String()
+		focus := e.erroredSpan(span.SpanContext().TraceID())
+		link := formatTraceLink(linkUrl, span.SpanContext().TraceID(), span.StartTime(), span.EndTime(), focus)
+		switch {
+		case e.logger != nil:
+			e.logger.LogAttrs(ctx, slog.LevelInfo, "Honeycomb trace link",
+				slog.String("name", span.Name()),
+				slog.String("trace_id", traceID),
+				slog.String("url", link),
+			)
+		case e.jsonLines:
+			if err := encoder.Encode(spanLinkRecord{Name: span.Name(), TraceID: traceID, URL: link}); err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintf(&buf, "Trace for %s\nHoneycomb link: %s\n", span.Name(), link)
 		}
 	}
+	if buf.Len() == 0 {
+		return nil
+	}
 
-	return nil
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.writer.Write(buf.Bytes())
+	return err
+}
+
+// rememberErroredSpans records the first errored span of each trace in spans, so that
+// links can focus on it when the trace's root span is exported, possibly in a later batch.
+func (e *spanLinkExporter) rememberErroredSpans(spans []trace.ReadOnlySpan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, span := range spans {
+		traceID := span.SpanContext().TraceID()
+		if _, ok := e.errored[traceID]; ok || !isErrorSpan(span) {
+			continue
+		}
+		if len(e.errored) >= maxErrorFocusTraces {
+			// traces whose root span is never exported here would otherwise build up
+			e.errored = map[oteltrace.TraceID]oteltrace.SpanID{}
+		}
+		e.errored[traceID] = span.SpanContext().SpanID()
+	}
+}
+
+// erroredSpan returns, and forgets, the errored span remembered for a trace.
+func (e *spanLinkExporter) erroredSpan(traceID oteltrace.TraceID) oteltrace.SpanID {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spanID := e.errored[traceID]
+	delete(e.errored, traceID)
+	return spanID
 }
 
 // Shutdown is called to stop the exporter, it preforms no action.
@@ -1,16 +1,186 @@
 package honeycomb
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 func TestSpanLinkExporterBuildsValidUrl(t *testing.T) {
 	t.Run("classic", func(t *testing.T) {
-		assert.Equal(t, "https://ui.honeycomb.io/my-team/datasets/my-service/trace?trace_id", buildTraceLinkUrl(true, "my-team", "my-env", "my-service"))
+		assert.Equal(t, "https://ui.honeycomb.io/my-team/datasets/my-service/trace?trace_id", buildTraceLinkUrl("https://ui.honeycomb.io", true, "my-team", "my-env", "my-service"))
 	})
 	t.Run("environment", func(t *testing.T) {
-		assert.Equal(t, "https://ui.honeycomb.io/my-team/environments/my-env/datasets/my-service/trace?trace_id", buildTraceLinkUrl(false, "my-team", "my-env", "my-service"))
+		assert.Equal(t, "https://ui.honeycomb.io/my-team/environments/my-env/datasets/my-service/trace?trace_id", buildTraceLinkUrl("https://ui.honeycomb.io", false, "my-team", "my-env", "my-service"))
 	})
+	t.Run("eu", func(t *testing.T) {
+		assert.Equal(t, "https://ui.eu1.honeycomb.io/my-team/environments/my-env/datasets/my-service/trace?trace_id", buildTraceLinkUrl("https://ui.eu1.honeycomb.io", false, "my-team", "my-env", "my-service"))
+	})
+}
+
+func TestUIBaseUrlForApiEndpoint(t *testing.T) {
+	testCases := []struct {
+		endpoint string
+		expected string
+	}{
+		{endpoint: "", expected: "https://ui.honeycomb.io"},
+		{endpoint: "https://api.honeycomb.io", expected: "https://ui.honeycomb.io"},
+		{endpoint: "api.honeycomb.io:443", expected: "https://ui.honeycomb.io"},
+		{endpoint: "https://api.eu1.honeycomb.io", expected: "https://ui.eu1.honeycomb.io"},
+		{endpoint: "api.eu1.honeycomb.io:443", expected: "https://ui.eu1.honeycomb.io"},
+		{endpoint: "https://API.EU1.HONEYCOMB.IO/", expected: "https://ui.eu1.honeycomb.io"},
+		{endpoint: "http://localhost:4318", expected: "https://ui.honeycomb.io"},
+		{endpoint: "collector.example.com:4317", expected: "https://ui.honeycomb.io"},
+		{endpoint: "api.honeycomb.io.example.com", expected: "https://ui.honeycomb.io"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.endpoint, func(t *testing.T) {
+			assert.Equal(t, tC.expected, uiBaseUrlForApiEndpoint(tC.endpoint))
+		})
+	}
+}
+
+func TestSpanLinkExporterApiEndpoint(t *testing.T) {
+	credentials := func() (string, string) { return "", "my-service" }
+	configEndpoint := ""
+	exporter := newSpanLinkExporter(newTraceLinkResolver(credentials))
+	exporter.configEndpoint = func() string { return configEndpoint }
+	assert.Equal(t, defaultApiEndpoint, exporter.honeycombApiEndpoint())
+
+	// the region is taken from the configured exporter endpoint
+	configEndpoint = "api.eu1.honeycomb.io:443"
+	assert.Equal(t, "api.eu1.honeycomb.io:443", exporter.honeycombApiEndpoint())
+	assert.True(t, strings.HasPrefix(exporter.traceLinkUrl(context.Background()), "https://ui.eu1.honeycomb.io/your-team/"))
+
+	// unless it isn't Honeycomb's
+	configEndpoint = "localhost:4317"
+	assert.Equal(t, defaultApiEndpoint, exporter.honeycombApiEndpoint())
+
+	// and an explicit endpoint or UI base URL wins
+	exporter = newSpanLinkExporter(newTraceLinkResolver(credentials), WithSpanLinkApiEndpoint("https://api.eu1.honeycomb.io"), WithUIBaseURL("https://honeycomb.example.com/"))
+	exporter.configEndpoint = func() string { return "api.honeycomb.io:443" }
+	assert.Equal(t, "https://api.eu1.honeycomb.io", exporter.honeycombApiEndpoint())
+	assert.True(t, strings.HasPrefix(exporter.traceLinkUrl(context.Background()), "https://honeycomb.example.com/your-team/"))
+}
+
+func testSpanLinkSpans() []trace.ReadOnlySpan {
+	traceID, _ := oteltrace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	rootID, _ := oteltrace.SpanIDFromHex("0102030405060708")
+	childID, _ := oteltrace.SpanIDFromHex("0807060504030201")
+	root := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{TraceID: traceID, SpanID: rootID})
+	child := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{TraceID: traceID, SpanID: childID})
+	return tracetest.SpanStubs{
+		{Name: "child", SpanContext: child, Parent: root},
+		{Name: "root", SpanContext: root},
+	}.Snapshots()
+}
+
+// newTestSpanLinkExporter returns an exporter looking up its team and environment from a
+// fake Honeycomb API, caching them in a temporary directory.
+func newTestSpanLinkExporter(t *testing.T, options ...SpanLinkExporterOption) *spanLinkExporter {
+	server := newTestAuthServer(t, http.StatusOK)
+	options = append([]SpanLinkExporterOption{WithSpanLinkApiEndpoint(server.URL)}, options...)
+	exporter, err := NewSpanLinkExporter("hcaik_test", "my-service", options...)
+	require.NoError(t, err)
+	exporter.auth.cacheDir = t.TempDir()
+	return exporter
+}
+
+func TestSpanLinkExporterWritesLinks(t *testing.T) {
+	link := "https://ui.honeycomb.io/my-team/environments/my-env/datasets/my-service/trace?trace_id=0102030405060708090a0b0c0d0e0f10"
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		exporter := newTestSpanLinkExporter(t, WithSpanLinkWriter(&buf))
+		require.NoError(t, exporter.ExportSpans(context.Background(), testSpanLinkSpans()))
+		assert.Equal(t, "Trace for root\nHoneycomb link: "+link+"\n", buf.String())
+	})
+	t.Run("json lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		exporter := newTestSpanLinkExporter(t, WithSpanLinkWriter(&buf), WithSpanLinkJSON())
+		require.NoError(t, exporter.ExportSpans(context.Background(), testSpanLinkSpans()))
+		assert.JSONEq(t, `{"name":"root","trace_id":"0102030405060708090a0b0c0d0e0f10","url":"`+link+`"}`, buf.String())
+		assert.True(t, strings.HasSuffix(buf.String(), "\n"))
+	})
+	t.Run("slog", func(t *testing.T) {
+		var buf bytes.Buffer
+		exporter := newTestSpanLinkExporter(t, WithSpanLinkLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+		require.NoError(t, exporter.ExportSpans(context.Background(), testSpanLinkSpans()))
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.Equal(t, "Honeycomb trace link", record["msg"])
+		assert.Equal(t, "root", record["name"])
+		assert.Equal(t, link, record["url"])
+	})
+}
+
+func TestSpanLinkExporterWritesPlaceholderWhenOffline(t *testing.T) {
+	var buf bytes.Buffer
+	server := newTestAuthServer(t, http.StatusOK)
+	server.Close()
+	exporter, err := NewSpanLinkExporter("hcaik_test", "my-service", WithSpanLinkApiEndpoint(server.URL), WithSpanLinkWriter(&buf))
+	require.NoError(t, err)
+	exporter.auth.cacheDir = t.TempDir()
+	exporter.auth.backoff = time.Millisecond
+
+	require.NoError(t, exporter.ExportSpans(context.Background(), testSpanLinkSpans()))
+	assert.Equal(t, "Trace for root\nHoneycomb link: https://ui.honeycomb.io/your-team/environments/your-environment/datasets/my-service/trace?trace_id=0102030405060708090a0b0c0d0e0f10\n", buf.String())
+}
+
+func TestLocalVisualizationsFromEnv(t *testing.T) {
+	assert.Empty(t, spanLinkOptionsFromSettings(configSettings{}))
+	t.Setenv("HONEYCOMB_LOCAL_VISUALIZATIONS_FORMAT", "json")
+	t.Setenv("HONEYCOMB_API_ENDPOINT", "https://api.eu1.honeycomb.io")
+	exporter := newSpanLinkExporter(newTraceLinkResolver(func() (string, string) { return "", "" }), spanLinkOptionsFromSettings(configSettings{})...)
+	assert.True(t, exporter.jsonLines)
+	assert.Equal(t, "https://api.eu1.honeycomb.io", exporter.honeycombApiEndpoint())
+}
+
+func TestLocalVisualizationsIgnoreCollectorEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"localhost:4318", "http://collector:4318"} {
+		t.Setenv("HONEYCOMB_API_ENDPOINT", endpoint)
+		assert.Empty(t, spanLinkOptionsFromSettings(configSettings{}), endpoint)
+		exporter := newSpanLinkExporter(newTraceLinkResolver(func() (string, string) { return "", "" }), spanLinkOptionsFromSettings(configSettings{})...)
+		assert.Equal(t, defaultApiEndpoint, exporter.honeycombApiEndpoint(), endpoint)
+	}
+}
+
+func TestLocalVisualizationsFromConfigFile(t *testing.T) {
+	t.Setenv("HONEYCOMB_API_ENDPOINT", "")
+	t.Setenv("HONEYCOMB_CONFIG_FILE", writeConfigFile(t, "honeycomb.yaml", "endpoint: https://api.eu1.honeycomb.io\n"))
+	settings, err := loadConfigSettings()
+	require.NoError(t, err)
+	exporter := newSpanLinkExporter(newTraceLinkResolver(func() (string, string) { return "", "" }), spanLinkOptionsFromSettings(settings)...)
+	assert.Equal(t, "https://api.eu1.honeycomb.io", exporter.honeycombApiEndpoint())
+}
+
+func TestSpanLinkExporterIncludesTimesAndErrorFocus(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := newTestSpanLinkExporter(t, WithSpanLinkWriter(&buf), WithSpanLinkJSON(), WithSpanLinkErrorFocus())
+	stubs := tracetest.SpanStubsFromReadOnlySpans(testSpanLinkSpans())
+	child, root := stubs[0], stubs[1]
+	child.Status = trace.Status{Code: codes.Error}
+	root.StartTime = time.Unix(1700000000, 500)
+	root.EndTime = time.Unix(1700000002, 100)
+
+	// the errored child is exported in an earlier batch than its root span
+	require.NoError(t, exporter.ExportSpans(context.Background(), tracetest.SpanStubs{child}.Snapshots()))
+	require.NoError(t, exporter.ExportSpans(context.Background(), tracetest.SpanStubs{root}.Snapshots()))
+
+	var record spanLinkRecord
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "https://ui.honeycomb.io/my-team/environments/my-env/datasets/my-service/trace?trace_id=0102030405060708090a0b0c0d0e0f10&trace_start_ts=1700000000&trace_end_ts=1700000003&span=0807060504030201", record.URL)
+	assert.Empty(t, exporter.errored)
 }
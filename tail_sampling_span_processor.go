@@ -0,0 +1,406 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/honeycombio/honeycomb-opentelemetry-go"
+
+	defaultTailSamplingDecisionWait     = 30 * time.Second
+	defaultTailSamplingMaxTraces        = 10000
+	defaultTailSamplingMaxSpansPerTrace = 1000
+
+	tailSamplingReasonError     = "error"
+	tailSamplingReasonSlow      = "slow"
+	tailSamplingReasonSampled   = "sampled"
+	tailSamplingReasonDropped   = "dropped"
+	tailSamplingTriggerTimeout  = "timeout"
+	tailSamplingTriggerEvicted  = "evicted"
+	tailSamplingTriggerComplete = "complete"
+	tailSamplingTriggerFlush    = "flush"
+)
+
+// TailSamplingConfig configures a tail sampling span processor.
+type TailSamplingConfig struct {
+	// DecisionWait is how long to wait for a trace's local root span to end before
+	// deciding with the spans received so far. Defaults to 30 seconds.
+	DecisionWait time.Duration
+	// MaxTraces bounds the number of traces buffered at once. When it is reached the oldest
+	// trace is decided early with the spans received so far. Defaults to 10000.
+	MaxTraces int
+	// MaxSpansPerTrace bounds the number of spans buffered for a single trace. Further spans
+	// are dropped. Defaults to 1000.
+	MaxSpansPerTrace int
+	// KeepErrors keeps every trace containing a span with an error status or an exception event.
+	KeepErrors bool
+	// KeepSlowerThan keeps every trace whose local root span lasted at least this long.
+	// Zero disables the rule.
+	KeepSlowerThan time.Duration
+	// SampleRate is applied, deterministically by trace ID, to traces not kept by another rule.
+	// Zero or less drops them. The decision uses a hash of the trace ID, so it is independent of
+	// head sampling by trace ID, such as by a DeterministicSampler, and the two rates multiply.
+	SampleRate int
+}
+
+// tailSamplingSpanProcessor buffers spans per trace until the trace's local root span ends
+// (or DecisionWait passes), then decides whether to keep the whole trace and forwards kept
+// traces to the wrapped exporter in batches.
+type tailSamplingSpanProcessor struct {
+	// export batches kept spans for the exporter, blocking when its queue is full rather than
+	// dropping them.
+	export trace.SpanProcessor
+	config TailSamplingConfig
+
+	mu      sync.Mutex
+	traces  map[oteltrace.TraceID]*list.Element
+	order   *list.List
+	decided *decisionCache
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+
+	tracesCounter  metric.Int64Counter
+	droppedCounter metric.Int64Counter
+}
+
+type bufferedTrace struct {
+	traceID oteltrace.TraceID
+	started time.Time
+	spans   []trace.ReadOnlySpan
+}
+
+var _ trace.SpanProcessor = (*tailSamplingSpanProcessor)(nil)
+
+// Returns a new tail sampling span processor that forwards kept traces to exporter.
+//
+// Kept spans carry a SampleRate attribute reflecting both the head sampling rate (if the
+// head sampler set one) and the rate applied by the processor. The processor exports spans
+// itself, batching them like a batch span processor, so it should be used in place of the span
+// processor that would otherwise export them, as WithTailSampling() does, rather than alongside
+// it.
+//
+// The processor reports traces kept and dropped, and spans dropped because of its memory
+// bounds, using the global OpenTelemetry meter provider.
+func NewTailSamplingSpanProcessor(exporter trace.SpanExporter, config TailSamplingConfig) trace.SpanProcessor {
+	if config.DecisionWait <= 0 {
+		config.DecisionWait = defaultTailSamplingDecisionWait
+	}
+	if config.MaxTraces <= 0 {
+		config.MaxTraces = defaultTailSamplingMaxTraces
+	}
+	if config.MaxSpansPerTrace <= 0 {
+		config.MaxSpansPerTrace = defaultTailSamplingMaxSpansPerTrace
+	}
+
+	meter := otel.Meter(instrumentationName)
+	tracesCounter, _ := meter.Int64Counter("honeycomb.tail_sampling.traces",
+		metric.WithDescription("Traces decided by the tail sampling span processor"))
+	droppedCounter, _ := meter.Int64Counter("honeycomb.tail_sampling.spans_dropped",
+		metric.WithDescription("Spans dropped by the tail sampling span processor because of its memory bounds"))
+
+	p := &tailSamplingSpanProcessor{
+		export:         trace.NewBatchSpanProcessor(exporter, trace.WithBlocking()),
+		config:         config,
+		traces:         map[oteltrace.TraceID]*list.Element{},
+		order:          list.New(),
+		decided:        newDecisionCache(config.MaxTraces),
+		stop:           make(chan struct{}),
+		tracesCounter:  tracesCounter,
+		droppedCounter: droppedCounter,
+	}
+	p.stopped.Add(1)
+	go p.run()
+	return p
+}
+
+// WithTailSampling() configures tail sampling of traces using a tail sampling span processor,
+// which exports the spans accepted by the configured sampler in place of the batch span processor
+// otelconfig uses, to the same endpoint.
+//
+// Spans are still sampled when they start, so other span processors, such as those for local
+// visualizations, see them and their sampling decision propagates to downstream services as
+// usual. Downstream services make their own tail sampling decisions, if any. It can't be used
+// together with WithErrorBiasedSampling(), which also replaces the batch span processor.
+func WithTailSampling(config TailSamplingConfig) otelconfig.Option {
+	return withSpanExport("WithTailSampling()", nil, func(exporter trace.SpanExporter) trace.SpanProcessor {
+		return NewTailSamplingSpanProcessor(exporter, config)
+	})
+}
+
+func (p *tailSamplingSpanProcessor) OnStart(context.Context, trace.ReadWriteSpan) {}
+
+func (p *tailSamplingSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	traceID := s.SpanContext().TraceID()
+
+	p.mu.Lock()
+	if rate, ok := p.decided.get(traceID); ok {
+		// a late span for a trace that has already been decided
+		p.mu.Unlock()
+		if rate > 0 {
+			p.export.OnEnd(withSampleRate(s, rate))
+		}
+		return
+	}
+
+	var bt *bufferedTrace
+	if elem, ok := p.traces[traceID]; ok {
+		bt = elem.Value.(*bufferedTrace)
+	} else {
+		if p.order.Len() >= p.config.MaxTraces {
+			p.decideLocked(p.order.Front(), tailSamplingTriggerEvicted)
+		}
+		bt = &bufferedTrace{traceID: traceID, started: time.Now()}
+		p.traces[traceID] = p.order.PushBack(bt)
+	}
+
+	// the local root is kept even over the limit, so that the trace is decided once it ends
+	if len(bt.spans) >= p.config.MaxSpansPerTrace && !isLocalRoot(s) {
+		p.mu.Unlock()
+		p.droppedCounter.Add(context.Background(), 1)
+		return
+	}
+	bt.spans = append(bt.spans, s)
+
+	if isLocalRoot(s) {
+		p.decideLocked(p.traces[traceID], tailSamplingTriggerComplete)
+	}
+	p.mu.Unlock()
+}
+
+func (p *tailSamplingSpanProcessor) Shutdown(ctx context.Context) error {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+	p.stopped.Wait()
+	p.decideAll()
+	return p.export.Shutdown(ctx)
+}
+
+// ForceFlush decides every buffered trace with the spans received so far and waits
+// for kept traces to be exported.
+func (p *tailSamplingSpanProcessor) ForceFlush(ctx context.Context) error {
+	p.decideAll()
+	return p.export.ForceFlush(ctx)
+}
+
+// decideAll decides every buffered trace with the spans received so far.
+func (p *tailSamplingSpanProcessor) decideAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.order.Len() > 0 {
+		p.decideLocked(p.order.Front(), tailSamplingTriggerFlush)
+	}
+}
+
+func (p *tailSamplingSpanProcessor) run() {
+	defer p.stopped.Done()
+
+	ticker := time.NewTicker(p.config.DecisionWait / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			for p.order.Len() > 0 {
+				front := p.order.Front()
+				if now.Sub(front.Value.(*bufferedTrace).started) < p.config.DecisionWait {
+					break
+				}
+				p.decideLocked(front, tailSamplingTriggerTimeout)
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// decideLocked removes a buffered trace, decides whether to keep it and queues kept spans
+// for export, waiting for room in the queue if it is full. Callers must hold p.mu.
+func (p *tailSamplingSpanProcessor) decideLocked(elem *list.Element, trigger string) {
+	bt := p.order.Remove(elem).(*bufferedTrace)
+	delete(p.traces, bt.traceID)
+
+	rate, reason := p.decide(bt)
+	p.decided.put(bt.traceID, rate)
+
+	decision := "kept"
+	if rate <= 0 {
+		decision = "dropped"
+	}
+	p.tracesCounter.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("decision", decision),
+		attribute.String("reason", reason),
+		attribute.String("trigger", trigger),
+	))
+	if rate <= 0 {
+		return
+	}
+
+	for _, s := range bt.spans {
+		p.export.OnEnd(withSampleRate(s, rate))
+	}
+}
+
+// decide returns the sample rate to apply to a trace, or zero to drop it, and the reason.
+func (p *tailSamplingSpanProcessor) decide(bt *bufferedTrace) (int, string) {
+	for _, s := range bt.spans {
+		if p.config.KeepErrors && isErrorSpan(s) {
+			return 1, tailSamplingReasonError
+		}
+		if p.config.KeepSlowerThan > 0 && isLocalRoot(s) && s.EndTime().Sub(s.StartTime()) >= p.config.KeepSlowerThan {
+			return 1, tailSamplingReasonSlow
+		}
+	}
+	if p.config.SampleRate <= 0 {
+		return 0, tailSamplingReasonDropped
+	}
+	if !tailSamplingKeeps(bt.traceID, p.config.SampleRate) {
+		return 0, tailSamplingReasonDropped
+	}
+	return p.config.SampleRate, tailSamplingReasonSampled
+}
+
+// tailSamplingKeeps reports whether to keep 1 in rate traces, deterministically by trace ID.
+// Head samplers such as the DeterministicSampler compare the trace ID's low bits to a threshold,
+// so a hash of the whole trace ID is used instead. Otherwise the traces kept here would all be
+// among those kept at the head, and the effective rate would be the larger of the two rather
+// than their product.
+func tailSamplingKeeps(traceID oteltrace.TraceID, rate int) bool {
+	if rate <= 1 {
+		return rate == 1
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(traceID[:])
+	// finalize the hash, so that every bit depends on every byte of the trace ID
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x < math.MaxUint64/uint64(rate)
+}
+
+func isLocalRoot(s trace.ReadOnlySpan) bool {
+	return !s.Parent().IsValid() || s.Parent().IsRemote()
+}
+
+func isErrorSpan(s trace.ReadOnlySpan) bool {
+	if s.Status().Code == codes.Error {
+		return true
+	}
+	for _, event := range s.Events() {
+		if event.Name == "exception" {
+			return true
+		}
+	}
+	return false
+}
+
+// sampledSpan overrides the SampleRate attribute of a span and marks it as sampled,
+// so that it is exported even if it was only recorded when it started.
+type sampledSpan struct {
+	trace.ReadOnlySpan
+	attributes []attribute.KeyValue
+}
+
+// withSampleRate returns s with its SampleRate attribute multiplied by rate,
+// or set to rate if s has no SampleRate attribute. This is the combined rate when s was sampled
+// independently of the decision to keep it at rate.
+func withSampleRate(s trace.ReadOnlySpan, rate int) trace.ReadOnlySpan {
+	return replaceSampleRate(s, func(sampleRate int64) int64 {
+		return sampleRate * int64(rate)
+	})
+}
+
+// withExactSampleRate returns s with its SampleRate attribute set to rate.
+func withExactSampleRate(s trace.ReadOnlySpan, rate int) trace.ReadOnlySpan {
+	return replaceSampleRate(s, func(int64) int64 {
+		return int64(rate)
+	})
+}
+
+// replaceSampleRate returns s as sampled, with its SampleRate attribute, 1 if it has none,
+// replaced by what newRate returns for it.
+func replaceSampleRate(s trace.ReadOnlySpan, newRate func(sampleRate int64) int64) trace.ReadOnlySpan {
+	original := s.Attributes()
+	attrs := make([]attribute.KeyValue, 0, len(original)+1)
+	sampleRate := int64(1)
+	for _, attr := range original {
+		if attr.Key == sampleRateAttributeKey {
+			sampleRate = attr.Value.AsInt64()
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	attrs = append(attrs, attribute.Int64(string(sampleRateAttributeKey), newRate(sampleRate)))
+	return sampledSpan{ReadOnlySpan: s, attributes: attrs}
+}
+
+func (s sampledSpan) Attributes() []attribute.KeyValue {
+	return s.attributes
+}
+
+func (s sampledSpan) SpanContext() oteltrace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
+
+// decisionCache remembers the sample rate chosen for recently decided traces, so that spans
+// ending after their trace was decided follow the same decision.
+type decisionCache struct {
+	rates map[oteltrace.TraceID]int
+	ring  []oteltrace.TraceID
+	next  int
+}
+
+func newDecisionCache(size int) *decisionCache {
+	return &decisionCache{
+		rates: make(map[oteltrace.TraceID]int, size),
+		ring:  make([]oteltrace.TraceID, size),
+	}
+}
+
+func (c *decisionCache) get(traceID oteltrace.TraceID) (int, bool) {
+	rate, ok := c.rates[traceID]
+	return rate, ok
+}
+
+func (c *decisionCache) put(traceID oteltrace.TraceID, rate int) {
+	if old := c.ring[c.next]; old.IsValid() {
+		delete(c.rates, old)
+	}
+	c.ring[c.next] = traceID
+	c.rates[traceID] = rate
+	c.next = (c.next + 1) % len(c.ring)
+}
@@ -0,0 +1,328 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/honeycomb-opentelemetry-go/honeycombtest"
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func newTailSamplingTracerProvider(config TailSamplingConfig) (*trace.TracerProvider, *testExporter, trace.SpanProcessor) {
+	exporter := NewTestExporter()
+	processor := NewTailSamplingSpanProcessor(exporter, config)
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(NewDeterministicSampler(1)),
+		trace.WithSpanProcessor(processor),
+	)
+	return tp, exporter, processor
+}
+
+func TestTailSamplingKeepsWholeTracesWithErrors(t *testing.T) {
+	tp, exporter, processor := newTailSamplingTracerProvider(TailSamplingConfig{KeepErrors: true})
+	tracer := tp.Tracer("test")
+
+	// an errored trace
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	root.End()
+
+	// a healthy trace
+	ctx, root = tracer.Start(context.Background(), "healthy root")
+	_, child = tracer.Start(ctx, "healthy child")
+	child.End()
+	root.End()
+
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Equal(t, 2, len(exporter.spans))
+	assert.Equal(t, "child", exporter.spans[0].Name())
+	assert.Equal(t, "root", exporter.spans[1].Name())
+	for _, s := range exporter.spans {
+		attr := getAttributeWithKey(s.Attributes(), "SampleRate")
+		if attr == nil {
+			t.Fatalf("SampleRate attribute was not found")
+		}
+		assert.Equal(t, int64(1), attr.Value.AsInt64())
+	}
+}
+
+func TestTailSamplingKeepsSlowTraces(t *testing.T) {
+	tp, exporter, processor := newTailSamplingTracerProvider(TailSamplingConfig{KeepSlowerThan: time.Second})
+	tracer := tp.Tracer("test")
+
+	start := time.Now()
+	_, root := tracer.Start(context.Background(), "slow", oteltrace.WithTimestamp(start))
+	root.End(oteltrace.WithTimestamp(start.Add(2 * time.Second)))
+	_, root = tracer.Start(context.Background(), "fast", oteltrace.WithTimestamp(start))
+	root.End(oteltrace.WithTimestamp(start.Add(time.Millisecond)))
+
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Equal(t, 1, len(exporter.spans))
+	assert.Equal(t, "slow", exporter.spans[0].Name())
+}
+
+func TestTailSamplingSamplesRemainingTraces(t *testing.T) {
+	tp, exporter, processor := newTailSamplingTracerProvider(TailSamplingConfig{SampleRate: 1})
+	tracer := tp.Tracer("test")
+
+	_, root := tracer.Start(context.Background(), "root")
+	root.End()
+
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Equal(t, 1, len(exporter.spans))
+}
+
+func TestTailSamplingDecidesIncompleteTracesAfterDecisionWait(t *testing.T) {
+	tp, exporter, processor := newTailSamplingTracerProvider(TailSamplingConfig{
+		KeepErrors:   true,
+		DecisionWait: 20 * time.Millisecond,
+	})
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.SetStatus(codes.Error, "boom")
+	child.End()
+
+	// the root span never ends; wait for the decision and an empty flush to synchronise with export
+	time.Sleep(100 * time.Millisecond)
+	processor.(*tailSamplingSpanProcessor).mu.Lock()
+	buffered := len(processor.(*tailSamplingSpanProcessor).traces)
+	processor.(*tailSamplingSpanProcessor).mu.Unlock()
+	assert.Equal(t, 0, buffered)
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Equal(t, 1, len(exporter.spans))
+	assert.Equal(t, "child", exporter.spans[0].Name())
+
+	// a late span follows the trace's decision
+	root.End()
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Equal(t, 2, len(exporter.spans))
+}
+
+func TestTailSamplingEvictsOldestTraceWhenFull(t *testing.T) {
+	tp, exporter, processor := newTailSamplingTracerProvider(TailSamplingConfig{
+		KeepErrors: true,
+		MaxTraces:  1,
+	})
+	tracer := tp.Tracer("test")
+
+	ctx, first := tracer.Start(context.Background(), "first root")
+	_, child := tracer.Start(ctx, "first child")
+	child.SetStatus(codes.Error, "boom")
+	child.End()
+
+	ctx, second := tracer.Start(context.Background(), "second root")
+	_, child = tracer.Start(ctx, "second child")
+	child.End()
+
+	p := processor.(*tailSamplingSpanProcessor)
+	p.mu.Lock()
+	assert.Equal(t, 1, p.order.Len())
+	p.mu.Unlock()
+
+	first.End()
+	second.End()
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Equal(t, 2, len(exporter.spans))
+	assert.Equal(t, "first child", exporter.spans[0].Name())
+	assert.Equal(t, "first root", exporter.spans[1].Name())
+}
+
+func TestTailSamplingShutdownFlushesBufferedTraces(t *testing.T) {
+	tp, exporter, processor := newTailSamplingTracerProvider(TailSamplingConfig{SampleRate: 1})
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+
+	require.NoError(t, processor.Shutdown(context.Background()))
+	require.Equal(t, 1, len(exporter.spans))
+	root.End()
+}
+
+func TestWithSampleRateMultipliesHeadSampleRate(t *testing.T) {
+	span := tracetest.SpanStub{
+		Attributes: []attribute.KeyValue{
+			attribute.String("a", "b"),
+			attribute.Int("SampleRate", 10),
+		},
+	}.Snapshot()
+
+	attrs := withSampleRate(span, 5).Attributes()
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("a", "b"),
+		attribute.Int64("SampleRate", 50),
+	}, attrs)
+	// the original span is left unchanged
+	assert.Equal(t, int64(10), getAttributeWithKey(span.Attributes(), "SampleRate").Value.AsInt64())
+}
+
+func TestTailSamplingDecidesWhenRootEndsOverSpanLimit(t *testing.T) {
+	tp, exporter, processor := newTailSamplingTracerProvider(TailSamplingConfig{
+		SampleRate:       1,
+		MaxSpansPerTrace: 1,
+	})
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	_, dropped := tracer.Start(ctx, "dropped")
+	dropped.End()
+	root.End()
+
+	p := processor.(*tailSamplingSpanProcessor)
+	p.mu.Lock()
+	assert.Equal(t, 0, p.order.Len())
+	p.mu.Unlock()
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Equal(t, 2, len(exporter.spans))
+	assert.Equal(t, "child", exporter.spans[0].Name())
+	assert.Equal(t, "root", exporter.spans[1].Name())
+}
+
+func TestTailSamplingShutdownExportsLateSpans(t *testing.T) {
+	tp, exporter, processor := newTailSamplingTracerProvider(TailSamplingConfig{SampleRate: 1})
+	tracer := tp.Tracer("test")
+
+	// a span ending after its trace was kept is still exported when shutting down
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, late := tracer.Start(ctx, "late")
+	root.End()
+	late.End()
+	require.NoError(t, processor.Shutdown(context.Background()))
+	require.Equal(t, 2, len(exporter.spans))
+	assert.Equal(t, "late", exporter.spans[1].Name())
+}
+
+func TestTailSamplingMultipliesHeadSampleRate(t *testing.T) {
+	for _, rates := range []struct{ head, tail int }{{10, 5}, {10, 20}} {
+		exporter := NewTestExporter()
+		processor := NewTailSamplingSpanProcessor(exporter, TailSamplingConfig{SampleRate: rates.tail})
+		tp := trace.NewTracerProvider(
+			trace.WithSampler(NewDeterministicSampler(rates.head)),
+			trace.WithSpanProcessor(processor),
+		)
+		tracer := tp.Tracer("test")
+
+		const traces = 100000
+		for i := 0; i < traces; i++ {
+			_, span := tracer.Start(context.Background(), "root")
+			span.End()
+		}
+		require.NoError(t, processor.Shutdown(context.Background()))
+
+		// the sample rates recorded estimate the number of traces
+		var weighted int64
+		for _, span := range exporter.spans {
+			weighted += getAttributeWithKey(span.Attributes(), "SampleRate").Value.AsInt64()
+		}
+		assert.InDelta(t, traces, weighted, traces*0.2, "head %d, tail %d", rates.head, rates.tail)
+	}
+}
+
+func TestTailSamplingExportsEveryKeptTraceInBursts(t *testing.T) {
+	tp, exporter, processor := newTailSamplingTracerProvider(TailSamplingConfig{SampleRate: 1})
+	tracer := tp.Tracer("test")
+
+	const traces = 20000
+	for i := 0; i < traces; i++ {
+		_, span := tracer.Start(context.Background(), "root")
+		span.End()
+	}
+	require.NoError(t, processor.Shutdown(context.Background()))
+	assert.Equal(t, traces, len(exporter.spans))
+}
+
+func TestTailSamplingCountsFlushedTraces(t *testing.T) {
+	reader := useManualMeterReader(t)
+	tp, _, processor := newTailSamplingTracerProvider(TailSamplingConfig{SampleRate: 1})
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	_, child := tp.Tracer("test").Start(ctx, "child")
+	child.End()
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	root.End()
+
+	points := sumDataPoints(t, reader, "honeycomb.tail_sampling.traces")
+	require.Len(t, points, 1)
+	trigger, _ := points[0].Attributes.Value("trigger")
+	assert.Equal(t, tailSamplingTriggerFlush, trigger.AsString())
+}
+
+func TestWithTailSamplingExportsSampledSpans(t *testing.T) {
+	config := freshConfig()
+	config.Sampler = NewDeterministicSampler(1)
+	WithTailSampling(TailSamplingConfig{KeepErrors: true})(config)
+
+	// spans stay sampled, so that they propagate and other span processors see them
+	assert.Equal(t, "DeterministicSampler", config.Sampler.Description())
+	assert.Empty(t, config.SpanProcessors)
+	exportSpans := takeConfigState(config).exportSpans
+	require.NotNil(t, exportSpans)
+	processor := exportSpans(NewTestExporter())
+	assert.IsType(t, &tailSamplingSpanProcessor{}, processor)
+	require.NoError(t, processor.Shutdown(context.Background()))
+}
+
+func TestTailSamplingReplacesBatchExport(t *testing.T) {
+	useValidateConfig(t)
+	server := honeycombtest.NewServer(t)
+	local := NewTestExporter()
+
+	options := append(server.GRPCOptions(),
+		otelconfig.WithMetricsEnabled(false),
+		WithApiKey("hcaik_01j0000000000000000000000000000000000000000000000000000000"),
+		otelconfig.WithSpanProcessor(trace.NewSimpleSpanProcessor(local)),
+		WithTailSampling(TailSamplingConfig{KeepErrors: true}),
+	)
+	shutdown, err := otelconfig.ConfigureOpenTelemetry(options...)
+	require.NoError(t, err)
+
+	tracer := otel.Tracer("test")
+	ctx, root := tracer.Start(context.Background(), "errored root")
+	_, child := tracer.Start(ctx, "child")
+	assert.True(t, child.SpanContext().IsSampled())
+	child.End()
+	root.SetStatus(codes.Error, "boom")
+	root.End()
+	_, healthy := tracer.Start(context.Background(), "healthy root")
+	healthy.End()
+	shutdown()
+
+	// every span is seen locally, but only the errored trace is exported
+	assert.Equal(t, 3, len(local.spans))
+	names := []string{}
+	for _, s := range server.Spans() {
+		names = append(names, s.Name)
+	}
+	assert.ElementsMatch(t, []string{"child", "errored root"}, names)
+}
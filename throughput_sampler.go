@@ -0,0 +1,110 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	defaultThroughputSamplerAdjustmentInterval = 5 * time.Second
+	throughputSamplerWeight                    = 0.5
+)
+
+// ThroughputSampler samples spans at a rate chosen to keep the number of sampled spans close to a
+// target number of events per second. The rate is recalculated from a moving average of observed
+// throughput and recorded on kept spans using the SampleRate attribute, like DeterministicSampler.
+type ThroughputSampler struct {
+	targetEPS float64
+	interval  time.Duration
+	now       func() time.Time
+
+	mu         sync.Mutex
+	lastUpdate time.Time
+	count      float64
+	averageEPS float64
+	sampler    DeterministicSampler
+}
+
+var _ trace.Sampler = (*ThroughputSampler)(nil)
+
+// Returns a new ThroughputSampler that aims to keep targetEPS spans per second.
+//
+// All spans are kept until enough traffic has been observed to choose a sample rate.
+func NewThroughputSampler(targetEPS float64) *ThroughputSampler {
+	return &ThroughputSampler{
+		targetEPS: targetEPS,
+		interval:  defaultThroughputSamplerAdjustmentInterval,
+		now:       time.Now,
+		sampler:   NewDeterministicSampler(1),
+	}
+}
+
+// WithThroughputSampler() sets the sampler used to sample trace spans to a ThroughputSampler
+// targeting eps sampled spans per second. Like the other Honeycomb samplers, it replaces a sampler
+// set with WithSampler() whichever option is applied last.
+func WithThroughputSampler(eps float64) otelconfig.Option {
+	return withFinalSampler(NewThroughputSampler(eps))
+}
+
+func (ts *ThroughputSampler) ShouldSample(parameters trace.SamplingParameters) trace.SamplingResult {
+	ts.mu.Lock()
+	now := ts.now()
+	if ts.lastUpdate.IsZero() {
+		ts.lastUpdate = now
+	} else if elapsed := now.Sub(ts.lastUpdate); elapsed >= ts.interval {
+		ts.updateSampleRate(elapsed)
+		ts.lastUpdate = now
+	}
+	ts.count++
+	sampler := ts.sampler
+	ts.mu.Unlock()
+
+	return sampler.ShouldSample(parameters)
+}
+
+func (ts *ThroughputSampler) Description() string {
+	return "ThroughputSampler"
+}
+
+// SampleRate returns the sample rate currently applied to new spans.
+func (ts *ThroughputSampler) SampleRate() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return int(ts.sampler.sampleRateAttribute.Value.AsInt64())
+}
+
+// updateSampleRate folds the last interval's throughput into the moving average
+// and picks a new sample rate. Callers must hold ts.mu.
+func (ts *ThroughputSampler) updateSampleRate(elapsed time.Duration) {
+	eps := ts.count / elapsed.Seconds()
+	ts.count = 0
+	if ts.averageEPS == 0 {
+		ts.averageEPS = eps
+	} else {
+		ts.averageEPS = throughputSamplerWeight*eps + (1-throughputSamplerWeight)*ts.averageEPS
+	}
+
+	rate := 1
+	if ts.targetEPS > 0 && ts.averageEPS > ts.targetEPS {
+		rate = int(math.Ceil(ts.averageEPS / ts.targetEPS))
+	}
+	ts.sampler = NewDeterministicSampler(rate)
+}
@@ -0,0 +1,107 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestThroughputSamplerAdjustsToTargetEPS(t *testing.T) {
+	now := time.Now()
+	sampler := NewThroughputSampler(10)
+	sampler.now = func() time.Time { return now }
+	assert.Equal(t, "ThroughputSampler", sampler.Description())
+
+	// everything is kept until traffic has been observed
+	result := sampler.ShouldSample(trace.SamplingParameters{})
+	assert.Equal(t, trace.RecordAndSample, result.Decision)
+	attr := getAttributeWithKey(result.Attributes, "SampleRate")
+	if attr == nil {
+		t.Fatalf("SampleRate attribute was not found")
+	}
+	assert.Equal(t, int64(1), attr.Value.AsInt64())
+
+	// 100 spans per second against a target of 10
+	for i := 1; i < 500; i++ {
+		sampler.ShouldSample(trace.SamplingParameters{})
+	}
+	now = now.Add(5 * time.Second)
+	sampler.ShouldSample(trace.SamplingParameters{})
+	assert.Equal(t, 10, sampler.SampleRate())
+
+	// traffic drops below the target
+	now = now.Add(5 * time.Second)
+	sampler.ShouldSample(trace.SamplingParameters{})
+	now = now.Add(5 * time.Second)
+	sampler.ShouldSample(trace.SamplingParameters{})
+	now = now.Add(5 * time.Second)
+	sampler.ShouldSample(trace.SamplingParameters{})
+	now = now.Add(5 * time.Second)
+	sampler.ShouldSample(trace.SamplingParameters{})
+	assert.Equal(t, 1, sampler.SampleRate())
+}
+
+func TestConfigureThroughputSampler(t *testing.T) {
+	t.Setenv("HONEYCOMB_SAMPLER_TARGET_EPS", "50")
+	config := freshConfig()
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	takeConfigState(config).applySamplers(config)
+	assert.Equal(t, "ThroughputSampler", config.Sampler.Description())
+}
+
+func TestThroughputSamplerSettingsAreValidated(t *testing.T) {
+	t.Setenv("HONEYCOMB_API_KEY", "123456789012345678901")
+	for _, eps := range []string{"0", "-5", "fast"} {
+		t.Setenv("HONEYCOMB_SAMPLER_TARGET_EPS", eps)
+		config := freshConfig()
+		logger := &captureLogger{}
+		config.Logger = logger
+		for _, setter := range getVendorOptionSetters() {
+			setter(config)
+		}
+		require.NoError(t, validateConfig(config))
+		assert.Equal(t, invalidSettingMessage, logger.Format)
+		assert.Equal(t, []interface{}{"HONEYCOMB_SAMPLER_TARGET_EPS", eps, "a number above 0"}, logger.Values)
+		assert.NotEqual(t, "ThroughputSampler", config.Sampler.Description())
+	}
+
+	// SAMPLE_RATE is ignored when a target is set
+	t.Setenv("HONEYCOMB_SAMPLER_TARGET_EPS", "50")
+	t.Setenv("SAMPLE_RATE", "10")
+	config := freshConfig()
+	logger := &captureLogger{}
+	config.Logger = logger
+	for _, setter := range getVendorOptionSetters() {
+		setter(config)
+	}
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, conflictingSampleRatesMessage, logger.Format)
+	assert.Equal(t, "ThroughputSampler", config.Sampler.Description())
+}
+
+func TestThroughputSamplerReplacesSampleRateWhicheverComesLast(t *testing.T) {
+	config := freshConfig()
+	WithThroughputSampler(50)(config)
+	WithSampler(10)(config)
+	takeConfigState(config).applySamplers(config)
+	assert.Equal(t, "ThroughputSampler", config.Sampler.Description())
+}
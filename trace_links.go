@@ -0,0 +1,231 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// queryLinkTimeRange is the time range, in seconds, of queries linked to by QueryLinkFor().
+const queryLinkTimeRange = 2 * 60 * 60
+
+// defaultTraceLinks resolves links for the most recently configured OpenTelemetry setup.
+var defaultTraceLinks atomic.Pointer[traceLinkResolver]
+
+// traceLinkResolver builds links to Honeycomb's UI, looking up the team and environment that
+// the API key belongs to from the API in the right region.
+type traceLinkResolver struct {
+	// credentials returns the API key and dataset to build links for. They are read
+	// when links are first needed, once configuration is complete.
+	credentials func() (apikey string, dataset string)
+	// configEndpoint returns the configured traces exporter endpoint, if known, which
+	// is used to find the Honeycomb region when no API endpoint has been set.
+	configEndpoint func() string
+	auth           *authLookup
+	apiEndpoint    string
+	uiBaseUrl      string
+}
+
+func newTraceLinkResolver(credentials func() (string, string)) *traceLinkResolver {
+	return &traceLinkResolver{
+		credentials: credentials,
+		auth:        newAuthLookup(),
+	}
+}
+
+// newConfigTraceLinkResolver returns a resolver using the API key, dataset and endpoint in c, and
+// the current API key from any providers recorded in state.
+// Traces are sent to a dataset named after the service, unless a classic API key and dataset
+// are configured.
+func newConfigTraceLinkResolver(c *otelconfig.Config, state *configState) *traceLinkResolver {
+	r := newTraceLinkResolver(func() (string, string) {
+		headers := currentTracesHeaders(c, state.apiKeys)
+		apikey, dataset := headers[honeycombApiKeyHeader], headers[honeycombDatasetHeader]
+		if dataset == "" || !isClassicApiKey(apikey) {
+			dataset = c.ServiceName
+		}
+		return apikey, dataset
+	})
+	r.configEndpoint = func() string {
+		endpoint, _, _ := tracesEndpoint(c)
+		return endpoint
+	}
+	return r
+}
+
+// honeycombApiEndpoint returns the Honeycomb API endpoint to look up teams from: the endpoint set
+// using WithSpanLinkApiEndpoint(), else the configured exporter endpoint if it is Honeycomb's,
+// else Honeycomb's US API.
+func (r *traceLinkResolver) honeycombApiEndpoint() string {
+	if r.apiEndpoint != "" {
+		return r.apiEndpoint
+	}
+	if r.configEndpoint != nil {
+		if endpoint := r.configEndpoint(); isHoneycombApiHost(endpointHost(endpoint)) {
+			return endpoint
+		}
+	}
+	return defaultApiEndpoint
+}
+
+// datasetUrl returns the link to the dataset traces are sent to, and whether the team and
+// environment could be looked up. If they couldn't, the link uses placeholders for them.
+func (r *traceLinkResolver) datasetUrl(ctx context.Context) (string, bool) {
+	return r.buildDatasetUrl(func(apiEndpoint string, apikey string) (*honeycombAuthResponse, bool) {
+		return r.auth.lookup(ctx, apiEndpoint, apikey)
+	})
+}
+
+// cachedDatasetUrl is like datasetUrl, but never waits for the team and environment to be looked
+// up, only starting to look them up if they aren't known yet.
+func (r *traceLinkResolver) cachedDatasetUrl() (string, bool) {
+	return r.buildDatasetUrl(r.auth.cached)
+}
+
+func (r *traceLinkResolver) buildDatasetUrl(lookup func(apiEndpoint string, apikey string) (*honeycombAuthResponse, bool)) (string, bool) {
+	apikey, dataset := r.credentials()
+	apiEndpoint := r.honeycombApiEndpoint()
+	uiBaseUrl := r.uiBaseUrl
+	if uiBaseUrl == "" {
+		uiBaseUrl = uiBaseUrlForApiEndpoint(apiEndpoint)
+	}
+	team, environment := placeholderTeam, placeholderEnvironment
+	auth, ok := lookup(apiEndpoint, apikey)
+	if ok {
+		team, environment = auth.Team.Slug, auth.Environment.Slug
+	}
+	return buildDatasetUrl(uiBaseUrl, isClassicApiKey(apikey), team, environment, dataset), ok
+}
+
+// traceLinkUrl returns the link to a trace, without its ID, falling back
+// to a placeholder when the team and environment can't be looked up.
+func (r *traceLinkResolver) traceLinkUrl(ctx context.Context) string {
+	datasetUrl, _ := r.datasetUrl(ctx)
+	return datasetUrl + traceLinkPath
+}
+
+// formatTraceLink completes a link returned by traceLinkUrl. The trace's start and end times
+// are included, when known, so that the UI doesn't need to search for the trace, and focus
+// selects a span in the trace when valid.
+func formatTraceLink(linkUrl string, traceID oteltrace.TraceID, start time.Time, end time.Time, focus oteltrace.SpanID) string {
+	link := fmt.Sprintf("%s=%s", linkUrl, traceID)
+	if !start.IsZero() {
+		link += "&trace_start_ts=" + strconv.FormatInt(start.Unix(), 10)
+	}
+	if !end.IsZero() {
+		// round up, so the range includes the whole trace
+		link += "&trace_end_ts=" + strconv.FormatInt(end.Add(time.Second-1).Unix(), 10)
+	}
+	if focus.IsValid() {
+		link += "&span=" + focus.String()
+	}
+	return link
+}
+
+// TraceLink returns a link to the trace in ctx in Honeycomb's UI, focused on the span in ctx, such
+// as to include in error pages, panic reports or logs, and whether a link could be made. Links use
+// the same team, environment and dataset as those written by WithLocalVisualizations(), and can
+// be made once OpenTelemetry has been configured and the team for the API key has been looked up
+// from Honeycomb. TraceLink never waits for that: the first calls start looking it up in the
+// background and return false until it is known.
+func TraceLink(ctx context.Context) (string, bool) {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	datasetUrl, ok := datasetUrlFor(sc)
+	if !ok {
+		return "", false
+	}
+	// the span's start is only known to be the trace's start for root spans
+	start := time.Time{}
+	if s, isSDKSpan := oteltrace.SpanFromContext(ctx).(trace.ReadOnlySpan); isSDKSpan && !s.Parent().IsValid() {
+		start = s.StartTime()
+	}
+	return formatTraceLink(datasetUrl+traceLinkPath, sc.TraceID(), start, time.Time{}, sc.SpanID()), true
+}
+
+// QueryLinkFor returns a link to a Honeycomb query for the spans of the trace in ctx, such as to
+// include in logs or error responses, and whether a link could be made. A link can be made once
+// OpenTelemetry has been configured and the team for the API key has been looked up from
+// Honeycomb. QueryLinkFor never waits for that: the first calls start looking it up in the
+// background and return false until it is known.
+func QueryLinkFor(ctx context.Context) (string, bool) {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	datasetUrl, ok := datasetUrlFor(sc)
+	if !ok {
+		return "", false
+	}
+	return buildQueryLinkUrl(datasetUrl, sc.TraceID(), spanStartTime(oteltrace.SpanFromContext(ctx))), true
+}
+
+// datasetUrlFor returns the link to the configured dataset, if a link can be made for sc without
+// waiting for the team to be looked up.
+func datasetUrlFor(sc oteltrace.SpanContext) (string, bool) {
+	resolver := defaultTraceLinks.Load()
+	if !sc.IsValid() || resolver == nil {
+		return "", false
+	}
+	return resolver.cachedDatasetUrl()
+}
+
+// spanStartTime returns the start time of span, if it was created by the OpenTelemetry SDK.
+func spanStartTime(span oteltrace.Span) time.Time {
+	if s, ok := span.(trace.ReadOnlySpan); ok {
+		return s.StartTime()
+	}
+	return time.Time{}
+}
+
+type honeycombQuery struct {
+	TimeRange    int                `json:"time_range"`
+	StartTime    int64              `json:"start_time,omitempty"`
+	Breakdowns   []string           `json:"breakdowns"`
+	Calculations []queryCalculation `json:"calculations"`
+	Filters      []queryFilter      `json:"filters"`
+}
+
+type queryCalculation struct {
+	Op string `json:"op"`
+}
+
+type queryFilter struct {
+	Column string `json:"column"`
+	Op     string `json:"op"`
+	Value  string `json:"value"`
+}
+
+// buildQueryLinkUrl returns a link to a query counting the spans in a trace by name. The query
+// is centred on start, when known, and otherwise covers the time before the link is opened.
+func buildQueryLinkUrl(datasetUrl string, traceID oteltrace.TraceID, start time.Time) string {
+	query := honeycombQuery{
+		TimeRange:    queryLinkTimeRange,
+		Breakdowns:   []string{"name"},
+		Calculations: []queryCalculation{{Op: "COUNT"}},
+		Filters:      []queryFilter{{Column: "trace.trace_id", Op: "=", Value: traceID.String()}},
+	}
+	if !start.IsZero() {
+		query.StartTime = start.Unix() - queryLinkTimeRange/2
+	}
+	data, _ := json.Marshal(query)
+	return datasetUrl + "?query=" + url.QueryEscape(string(data))
+}
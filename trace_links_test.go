@@ -0,0 +1,141 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// useTestTraceLinks points the trace link helpers at a fake Honeycomb API for the duration of a test.
+func useTestTraceLinks(t *testing.T, apikey string, dataset string) {
+	server := newTestAuthServer(t, http.StatusOK)
+	resolver := newTraceLinkResolver(func() (string, string) { return apikey, dataset })
+	resolver.apiEndpoint = server.URL
+	resolver.auth.cacheDir = t.TempDir()
+
+	previous := defaultTraceLinks.Swap(resolver)
+	t.Cleanup(func() { defaultTraceLinks.Store(previous) })
+}
+
+// eventuallyLinked waits for link to return a link, as it does once the team has been looked up.
+func eventuallyLinked(t *testing.T, link func() (string, bool)) string {
+	var linked string
+	require.Eventually(t, func() bool {
+		var ok bool
+		linked, ok = link()
+		return ok
+	}, time.Second, time.Millisecond)
+	return linked
+}
+
+func TestFormatTraceLink(t *testing.T) {
+	traceID, _ := oteltrace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := oteltrace.SpanIDFromHex("0102030405060708")
+	link := "https://ui.honeycomb.io/t/environments/e/datasets/d/trace?trace_id"
+
+	assert.Equal(t, link+"=0102030405060708090a0b0c0d0e0f10", formatTraceLink(link, traceID, time.Time{}, time.Time{}, oteltrace.SpanID{}))
+	assert.Equal(t, link+"=0102030405060708090a0b0c0d0e0f10&trace_start_ts=100&trace_end_ts=102&span=0102030405060708",
+		formatTraceLink(link, traceID, time.Unix(100, 999), time.Unix(101, 1), spanID))
+	assert.Equal(t, link+"=0102030405060708090a0b0c0d0e0f10&trace_start_ts=100&trace_end_ts=101",
+		formatTraceLink(link, traceID, time.Unix(100, 0), time.Unix(101, 0), oteltrace.SpanID{}))
+}
+
+func TestQueryLinkFor(t *testing.T) {
+	useTestTraceLinks(t, "hcaik_test", "my-service")
+
+	_, ok := QueryLinkFor(context.Background())
+	assert.False(t, ok)
+
+	tp := trace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	// the team is looked up in the background
+	_, ok = QueryLinkFor(ctx)
+	assert.False(t, ok)
+	link := eventuallyLinked(t, func() (string, bool) { return QueryLinkFor(ctx) })
+	prefix := "https://ui.honeycomb.io/my-team/environments/my-env/datasets/my-service?query="
+	require.True(t, strings.HasPrefix(link, prefix), link)
+
+	queryJSON, err := url.QueryUnescape(strings.TrimPrefix(link, prefix))
+	require.NoError(t, err)
+	var query honeycombQuery
+	require.NoError(t, json.Unmarshal([]byte(queryJSON), &query))
+	assert.Equal(t, []queryFilter{{Column: "trace.trace_id", Op: "=", Value: span.SpanContext().TraceID().String()}}, query.Filters)
+	assert.Equal(t, span.(trace.ReadOnlySpan).StartTime().Unix()-queryLinkTimeRange/2, query.StartTime)
+	assert.Equal(t, queryLinkTimeRange, query.TimeRange)
+}
+
+func TestQueryLinkForWithoutTeam(t *testing.T) {
+	useTestTraceLinks(t, "", "my-service")
+
+	tp := trace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	_, ok := QueryLinkFor(ctx)
+	assert.False(t, ok)
+}
+
+func TestConfigTraceLinkDataset(t *testing.T) {
+	classicKey := "12345678901234567890123456789012"
+
+	config := freshConfig()
+	config.ServiceName = "my-service"
+	WithApiKey("hcaik_test")(config)
+	WithDataset("my-dataset")(config)
+	_, dataset := newConfigTraceLinkResolver(config, &configState{}).credentials()
+	assert.Equal(t, "my-service", dataset)
+
+	WithTracesApiKey(classicKey)(config)
+	apikey, dataset := newConfigTraceLinkResolver(config, &configState{}).credentials()
+	assert.Equal(t, classicKey, apikey)
+	assert.Equal(t, "my-dataset", dataset)
+}
+
+func TestTraceLink(t *testing.T) {
+	useTestTraceLinks(t, "hcaik_test", "my-service")
+
+	_, ok := TraceLink(context.Background())
+	assert.False(t, ok)
+
+	tp := trace.NewTracerProvider()
+	ctx, root := tp.Tracer("test").Start(context.Background(), "request")
+	defer root.End()
+	link := eventuallyLinked(t, func() (string, bool) { return TraceLink(ctx) })
+	start := root.(trace.ReadOnlySpan).StartTime().Unix()
+	assert.Equal(t, formatTraceLink("https://ui.honeycomb.io/my-team/environments/my-env/datasets/my-service/trace?trace_id",
+		root.SpanContext().TraceID(), time.Unix(start, 0), time.Time{}, root.SpanContext().SpanID()), link)
+	assert.Contains(t, link, "&span="+root.SpanContext().SpanID().String())
+
+	// child spans don't know when their trace started
+	ctx, child := tp.Tracer("test").Start(ctx, "query")
+	defer child.End()
+	link, ok = TraceLink(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "https://ui.honeycomb.io/my-team/environments/my-env/datasets/my-service/trace?trace_id="+
+		child.SpanContext().TraceID().String()+"&span="+child.SpanContext().SpanID().String(), link)
+}
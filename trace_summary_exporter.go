@@ -0,0 +1,164 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	summaryNameWidth      = 40
+	summaryBarWidth       = 40
+	summaryMaxValueLength = 40
+)
+
+// summaryAttributeKeys are the attributes shown for each span in a trace summary, when present.
+var summaryAttributeKeys = []attribute.Key{
+	"http.method",
+	"http.request.method",
+	"http.route",
+	"http.status_code",
+	"http.response.status_code",
+	"rpc.method",
+	"db.system",
+	"db.statement",
+	"messaging.destination.name",
+	"SampleRate",
+}
+
+// traceSummaryExporter prints an ASCII waterfall of each trace once its local root span ends.
+type traceSummaryExporter struct {
+	traces *traceAssembler
+
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+var _ trace.SpanExporter = (*traceSummaryExporter)(nil)
+
+// WithLocalTraceSummary() prints a summary of each trace to w as its root span ends, showing the
+// tree of spans as a waterfall with their durations, errors and key attributes. Summaries are
+// printed to stdout when w is nil. This is intended for local development.
+func WithLocalTraceSummary(w io.Writer) otelconfig.Option {
+	return otelconfig.WithSpanProcessor(trace.NewBatchSpanProcessor(newTraceSummaryExporter(w)))
+}
+
+func newTraceSummaryExporter(w io.Writer) *traceSummaryExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &traceSummaryExporter{
+		traces: newTraceAssembler(defaultMaxPendingTraces),
+		writer: w,
+	}
+}
+
+func (e *traceSummaryExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	var buf bytes.Buffer
+	for _, t := range e.traces.add(spans) {
+		writeTraceSummary(&buf, t)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.writer.Write(buf.Bytes())
+	return err
+}
+
+func (e *traceSummaryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// writeTraceSummary writes a header line for t followed by a line for each span, for example:
+//
+//	Trace 0102...0f10: GET /users (3 spans, 120.0ms)
+//	GET /users                               |========================================| 120.0ms http.route=/users
+//	|- SELECT users                          |    =============                       |  40.0ms db.system=postgresql
+//	`- render                                |                   ==========           |  30.0ms ERROR: template missing
+func writeTraceSummary(w io.Writer, t *localTrace) {
+	start, end := t.start(), t.end()
+	total := end.Sub(start)
+	fmt.Fprintf(w, "Trace %s: %s (%d spans, %s)\n", t.id, t.root.Name(), len(t.spans), formatSpanDuration(total))
+
+	var writeNode func(node *spanNode, prefix string, connector string, childPrefix string)
+	writeNode = func(node *spanNode, prefix string, connector string, childPrefix string) {
+		s := node.span
+		label := truncateSummary(prefix+connector+s.Name(), summaryNameWidth)
+
+		offset, width := 0, summaryBarWidth
+		if total > 0 {
+			offset = int(float64(s.StartTime().Sub(start)) / float64(total) * summaryBarWidth)
+			width = int(math.Ceil(float64(s.EndTime().Sub(s.StartTime())) / float64(total) * summaryBarWidth))
+		}
+		offset = min(max(offset, 0), summaryBarWidth-1)
+		width = min(max(width, 1), summaryBarWidth-offset)
+		bar := strings.Repeat(" ", offset) + strings.Repeat("=", width) + strings.Repeat(" ", summaryBarWidth-offset-width)
+
+		details := summaryAttributes(s)
+		if isErrorSpan(s) {
+			details = append([]string{strings.TrimSpace("ERROR: " + s.Status().Description)}, details...)
+		}
+		line := fmt.Sprintf("%-*s |%s| %8s %s", summaryNameWidth, label, bar, formatSpanDuration(s.EndTime().Sub(s.StartTime())), strings.Join(details, " "))
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+
+		for i, child := range node.children {
+			if i == len(node.children)-1 {
+				writeNode(child, prefix+childPrefix, "`- ", "   ")
+			} else {
+				writeNode(child, prefix+childPrefix, "|- ", "|  ")
+			}
+		}
+	}
+	for _, root := range buildSpanTree(t.spans) {
+		writeNode(root, "", "", "")
+	}
+}
+
+// summaryAttributes returns the key attributes of s formatted as key=value.
+func summaryAttributes(s trace.ReadOnlySpan) []string {
+	var details []string
+	for _, key := range summaryAttributeKeys {
+		for _, attr := range s.Attributes() {
+			if attr.Key == key {
+				details = append(details, fmt.Sprintf("%s=%s", key, truncateSummary(attr.Value.Emit(), summaryMaxValueLength)))
+				break
+			}
+		}
+	}
+	return details
+}
+
+// truncateSummary shortens s to at most n characters, marking where it was cut.
+func truncateSummary(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,58 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceSummaryExporterPrintsWaterfall(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := newTraceSummaryExporter(&buf)
+
+	query := treeTestSpan(1, 2, 1, "SELECT users", 10, 50)
+	query.Attributes = []attribute.KeyValue{attribute.String("db.system", "postgresql"), attribute.String("ignored", "value")}
+	render := treeTestSpan(1, 3, 1, "render", 60, 90)
+	render.Status = trace.Status{Code: codes.Error, Description: "template missing"}
+	template := treeTestSpan(1, 4, 3, "load template", 60, 70)
+	root := treeTestSpan(1, 1, 0, "GET /users", 0, 100)
+	root.Attributes = []attribute.KeyValue{attribute.String("http.route", "/users"), attribute.Int("http.status_code", 500)}
+
+	require.NoError(t, exporter.ExportSpans(context.Background(), tracetest.SpanStubs{query, template, render}.Snapshots()))
+	assert.Empty(t, buf.String())
+	require.NoError(t, exporter.ExportSpans(context.Background(), tracetest.SpanStubs{root}.Snapshots()))
+
+	expected := "" +
+		"Trace 00000000000000000000000000000001: GET /users (4 spans, 100.0ms)\n" +
+		"GET /users                               |========================================|  100.0ms http.route=/users http.status_code=500\n" +
+		"|- SELECT users                          |    ================                    |   40.0ms db.system=postgresql\n" +
+		"`- render                                |                        ============    |   30.0ms ERROR: template missing\n" +
+		"   `- load template                      |                        ====            |   10.0ms\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestTruncateSummary(t *testing.T) {
+	assert.Equal(t, "short", truncateSummary("short", 10))
+	assert.Equal(t, "a long...", truncateSummary("a long name", 9))
+}
@@ -0,0 +1,172 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// defaultMaxPendingTraces is the number of incomplete traces a traceAssembler buffers by default.
+const defaultMaxPendingTraces = 1000
+
+// localTrace is a trace assembled from the spans exported by this process.
+type localTrace struct {
+	id    oteltrace.TraceID
+	root  trace.ReadOnlySpan
+	spans []trace.ReadOnlySpan
+}
+
+// start returns the earliest start time of the trace's spans.
+func (t *localTrace) start() time.Time {
+	start := t.root.StartTime()
+	for _, s := range t.spans {
+		if s.StartTime().Before(start) {
+			start = s.StartTime()
+		}
+	}
+	return start
+}
+
+// end returns the latest end time of the trace's spans.
+func (t *localTrace) end() time.Time {
+	end := t.root.EndTime()
+	for _, s := range t.spans {
+		if s.EndTime().After(end) {
+			end = s.EndTime()
+		}
+	}
+	return end
+}
+
+// hasError reports whether any span in the trace has an error.
+func (t *localTrace) hasError() bool {
+	for _, s := range t.spans {
+		if isErrorSpan(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// traceAssembler groups exported spans by trace, completing a trace when its local root span
+// ends. Spans that end after their local root span are not included in the trace.
+type traceAssembler struct {
+	maxPending int
+
+	mu      sync.Mutex
+	pending map[oteltrace.TraceID][]trace.ReadOnlySpan
+	order   []oteltrace.TraceID
+}
+
+func newTraceAssembler(maxPending int) *traceAssembler {
+	return &traceAssembler{
+		maxPending: maxPending,
+		pending:    map[oteltrace.TraceID][]trace.ReadOnlySpan{},
+	}
+}
+
+// add buffers spans, returning the traces they complete in the order their root spans ended.
+// When more than maxPending traces are incomplete, the oldest are discarded.
+func (a *traceAssembler) add(spans []trace.ReadOnlySpan) []*localTrace {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var completed []*localTrace
+	for _, s := range spans {
+		id := s.SpanContext().TraceID()
+		buffered, ok := a.pending[id]
+		if !ok {
+			a.order = append(a.order, id)
+		}
+		buffered = append(buffered, s)
+		if isLocalRoot(s) {
+			delete(a.pending, id)
+			completed = append(completed, &localTrace{id: id, root: s, spans: buffered})
+			continue
+		}
+		a.pending[id] = buffered
+	}
+
+	for len(a.pending) > a.maxPending {
+		id := a.order[0]
+		a.order = a.order[1:]
+		delete(a.pending, id)
+	}
+	// drop the IDs of completed traces once they outnumber pending ones
+	if len(a.order) > 2*len(a.pending)+a.maxPending {
+		order := a.order[:0]
+		for _, id := range a.order {
+			if _, ok := a.pending[id]; ok {
+				order = append(order, id)
+			}
+		}
+		a.order = order
+	}
+	return completed
+}
+
+// spanNode is a span and its children in a trace.
+type spanNode struct {
+	span     trace.ReadOnlySpan
+	children []*spanNode
+}
+
+// buildSpanTree arranges spans by parent, returning the top level spans. Spans whose parent is
+// not among spans, such as the children of remote parents, are at the top level. Siblings are
+// ordered by start time.
+func buildSpanTree(spans []trace.ReadOnlySpan) []*spanNode {
+	nodes := make(map[oteltrace.SpanID]*spanNode, len(spans))
+	for _, s := range spans {
+		nodes[s.SpanContext().SpanID()] = &spanNode{span: s}
+	}
+	var roots []*spanNode
+	for _, s := range spans {
+		node := nodes[s.SpanContext().SpanID()]
+		if parent, ok := nodes[s.Parent().SpanID()]; ok && parent != node {
+			parent.children = append(parent.children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	sortSpanNodes(roots)
+	return roots
+}
+
+func sortSpanNodes(nodes []*spanNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].span.StartTime().Before(nodes[j].span.StartTime())
+	})
+	for _, node := range nodes {
+		sortSpanNodes(node.children)
+	}
+}
+
+// formatSpanDuration formats d compactly, using plain ASCII units.
+func formatSpanDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%dus", d.Microseconds())
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+var treeTestStart = time.Unix(1700000000, 0)
+
+// treeTestSpan returns a span in trace number traceNum with the given span and parent numbers,
+// where a parent of 0 means a root span, starting and ending at the given milliseconds.
+func treeTestSpan(traceNum byte, spanNum byte, parentNum byte, name string, startMs int, endMs int) tracetest.SpanStub {
+	traceID := oteltrace.TraceID{15: traceNum}
+	stub := tracetest.SpanStub{
+		Name:        name,
+		SpanContext: oteltrace.NewSpanContext(oteltrace.SpanContextConfig{TraceID: traceID, SpanID: oteltrace.SpanID{7: spanNum}}),
+		StartTime:   treeTestStart.Add(time.Duration(startMs) * time.Millisecond),
+		EndTime:     treeTestStart.Add(time.Duration(endMs) * time.Millisecond),
+	}
+	if parentNum != 0 {
+		stub.Parent = oteltrace.NewSpanContext(oteltrace.SpanContextConfig{TraceID: traceID, SpanID: oteltrace.SpanID{7: parentNum}})
+	}
+	return stub
+}
+
+func spanNames(nodes []*spanNode) []string {
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.span.Name())
+	}
+	return names
+}
+
+func TestTraceAssemblerCompletesTracesAtLocalRoot(t *testing.T) {
+	assembler := newTraceAssembler(10)
+
+	completed := assembler.add(tracetest.SpanStubs{
+		treeTestSpan(1, 2, 1, "child", 10, 20),
+		treeTestSpan(2, 2, 1, "other child", 10, 20),
+	}.Snapshots())
+	assert.Empty(t, completed)
+
+	completed = assembler.add(tracetest.SpanStubs{
+		treeTestSpan(1, 1, 0, "root", 0, 30),
+	}.Snapshots())
+	require.Len(t, completed, 1)
+	assert.Equal(t, oteltrace.TraceID{15: 1}, completed[0].id)
+	assert.Equal(t, "root", completed[0].root.Name())
+	assert.Len(t, completed[0].spans, 2)
+	assert.Equal(t, treeTestStart, completed[0].start())
+	assert.Equal(t, treeTestStart.Add(30*time.Millisecond), completed[0].end())
+	assert.Len(t, assembler.pending, 1)
+}
+
+func TestTraceAssemblerDiscardsOldestPendingTraces(t *testing.T) {
+	assembler := newTraceAssembler(2)
+	for i := byte(1); i <= 3; i++ {
+		assembler.add(tracetest.SpanStubs{treeTestSpan(i, 2, 1, "child", 0, 10)}.Snapshots())
+	}
+	assert.Len(t, assembler.pending, 2)
+
+	completed := assembler.add(tracetest.SpanStubs{treeTestSpan(1, 1, 0, "root", 0, 10)}.Snapshots())
+	require.Len(t, completed, 1)
+	assert.Len(t, completed[0].spans, 1)
+
+	completed = assembler.add(tracetest.SpanStubs{treeTestSpan(3, 1, 0, "root", 0, 10)}.Snapshots())
+	require.Len(t, completed, 1)
+	assert.Len(t, completed[0].spans, 2)
+}
+
+func TestBuildSpanTree(t *testing.T) {
+	spans := tracetest.SpanStubs{
+		treeTestSpan(1, 3, 1, "second", 20, 30),
+		treeTestSpan(1, 4, 2, "grandchild", 5, 8),
+		treeTestSpan(1, 2, 1, "first", 0, 10),
+		treeTestSpan(1, 5, 9, "orphan", 1, 2),
+		treeTestSpan(1, 1, 0, "root", 0, 30),
+	}.Snapshots()
+
+	roots := buildSpanTree(spans)
+	assert.Equal(t, []string{"root", "orphan"}, spanNames(roots))
+	assert.Equal(t, []string{"first", "second"}, spanNames(roots[0].children))
+	assert.Equal(t, []string{"grandchild"}, spanNames(roots[0].children[0].children))
+}
+
+func TestFormatSpanDuration(t *testing.T) {
+	assert.Equal(t, "1.50s", formatSpanDuration(1500*time.Millisecond))
+	assert.Equal(t, "12.3ms", formatSpanDuration(12300*time.Microsecond))
+	assert.Equal(t, "250us", formatSpanDuration(250*time.Microsecond))
+}
@@ -0,0 +1,304 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// configProblem is a likely misconfiguration. It is logged at debug level, or returned as an
+// error from ConfigureOpenTelemetry() when strict validation is enabled.
+type configProblem struct {
+	format string
+	args   []interface{}
+	// warn logs the problem even when debug logging is off, for problems that stop telemetry
+	// from being accepted at all.
+	warn bool
+}
+
+func (p configProblem) Error() string {
+	return fmt.Sprintf(p.format, p.args...)
+}
+
+// configState is what options have recorded about a config for validateConfig to act on.
+type configState struct {
+	strict   bool
+	problems []configProblem
+	// keyValidator checks API keys with Honeycomb, if enabled.
+	keyValidator *keyValidator
+	// apiKeys are the API key providers configured, if any.
+	apiKeys *apiKeyProviders
+	// sampler replaces the configured sampler once all options have been applied, if set.
+	sampler trace.Sampler
+	// samplerWrappers are applied to the final sampler, in order.
+	samplerWrappers []func(trace.Sampler) trace.Sampler
+	// exportSpans returns the span processor that exports spans in place of otelconfig's batch
+	// span processor, if set, and exportSampler wraps the final sampler for it, if set.
+	// exportName is the option that set them.
+	exportSpans   func(trace.SpanExporter) trace.SpanProcessor
+	exportSampler func(trace.Sampler) trace.Sampler
+	exportName    string
+	// setups start things that should only run once the config is known to be valid.
+	setups []setupStep
+	// tracesEnabled enables or disables traces once otelconfig has read the environment, if set.
+	tracesEnabled *bool
+}
+
+// setupStep starts something that should only run once a config has been validated, such as a
+// background goroutine, returning a function that stops it.
+type setupStep func(c *otelconfig.Config) (stop func(), err error)
+
+// configStates holds the configState for each config until it is validated. Options can only
+// reach the config they're applied to, so this is how they hand state to validateConfig, which
+// takes it out again before doing anything else so that it's never kept once validation is over.
+var configStates sync.Map
+
+func stateFor(c *otelconfig.Config) *configState {
+	s, _ := configStates.LoadOrStore(c, &configState{})
+	return s.(*configState)
+}
+
+// takeConfigState returns and forgets what has been recorded for c.
+func takeConfigState(c *otelconfig.Config) *configState {
+	if s, ok := configStates.LoadAndDelete(c); ok {
+		return s.(*configState)
+	}
+	return &configState{}
+}
+
+// WithStrictValidation() makes ConfigureOpenTelemetry() return an error for likely
+// misconfigurations that are otherwise only logged at debug level, such as a missing API key,
+// a classic API key without a dataset, a malformed endpoint or an unparseable sample rate, so
+// that misconfigured deployments fail fast.
+func WithStrictValidation() otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		stateFor(c).strict = true
+	}
+}
+
+// withConfigProblem() records a problem to be reported when c is validated.
+func withConfigProblem(format string, args ...interface{}) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		v := stateFor(c)
+		v.problems = append(v.problems, configProblem{format: format, args: args})
+	}
+}
+
+// withConfigWarning() records a problem to be reported when c is validated, as a warning rather
+// than at debug level, for problems that change what is sent.
+func withConfigWarning(format string, args ...interface{}) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		v := stateFor(c)
+		v.problems = append(v.problems, configProblem{format: format, args: args, warn: true})
+	}
+}
+
+// withSetup() records a step to run once c has been validated.
+func withSetup(step setupStep) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		v := stateFor(c)
+		v.setups = append(v.setups, step)
+	}
+}
+
+// withTracesEnabled() enables or disables traces for c. otelconfig enables them when
+// OTEL_TRACES_ENABLED isn't set, whatever options set, so this is applied when c is validated.
+func withTracesEnabled(enabled bool) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		stateFor(c).tracesEnabled = &enabled
+	}
+}
+
+// withFinalSampler() makes sampler the one used for c, in place of any sampler set directly on c,
+// such as by WithSampler(), even by options applied after this one. Of the options using this, the
+// last applied wins.
+func withFinalSampler(sampler trace.Sampler) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		stateFor(c).sampler = sampler
+	}
+}
+
+// withSamplerWrapper() records wrap to be applied to the sampler for c once all options have been
+// applied, so that it wraps the final sampler whichever option sets it.
+func withSamplerWrapper(wrap func(trace.Sampler) trace.Sampler) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		v := stateFor(c)
+		v.samplerWrappers = append(v.samplerWrappers, wrap)
+	}
+}
+
+// withSpanExport() makes spans for c be exported by the span processor that exportSpans returns
+// for the traces exporter, in place of a batch span processor. If wrapSampler is not nil, it wraps
+// the final sampler, after any other wrappers, for the decisions that span processor relies on.
+// Only one option, named by name, can set the export stage, so if another one already has, the
+// last one applied is used and the conflict is reported as a configuration problem.
+func withSpanExport(name string, wrapSampler func(trace.Sampler) trace.Sampler, exportSpans func(trace.SpanExporter) trace.SpanProcessor) otelconfig.Option {
+	return func(c *otelconfig.Config) {
+		v := stateFor(c)
+		if v.exportName != "" && v.exportName != name {
+			v.problems = append(v.problems, configProblem{
+				format: conflictingSpanExportMessage,
+				args:   []interface{}{name, v.exportName},
+				warn:   true,
+			})
+		}
+		v.exportSampler = wrapSampler
+		v.exportSpans = exportSpans
+		v.exportName = name
+	}
+}
+
+// applySamplers sets the sampler for c to the final sampler recorded by options, if any, wrapped
+// by the recorded wrappers and instrumented, so that the decisions counted are the ones it makes
+// before the export stage, if any, adjusts them.
+func (v *configState) applySamplers(c *otelconfig.Config) {
+	if v.sampler != nil {
+		c.Sampler = v.sampler
+	}
+	for _, wrap := range v.samplerWrappers {
+		c.Sampler = wrap(c.Sampler)
+	}
+	instrumentSampler(c)
+	if v.exportSampler != nil {
+		c.Sampler = v.exportSampler(c.Sampler)
+	}
+}
+
+// runSetups runs the setup steps recorded for c in order. If one fails, the steps already run are
+// stopped and its error is returned. Otherwise they are stopped when OpenTelemetry is shut down,
+// which also happens if otelconfig then fails to set up its pipelines.
+func (v *configState) runSetups(c *otelconfig.Config) error {
+	var stops []func()
+	stopAll := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	for _, setup := range v.setups {
+		stop, err := setup(c)
+		if err != nil {
+			stopAll()
+			return err
+		}
+		if stop != nil {
+			stops = append(stops, stop)
+		}
+	}
+	if len(stops) > 0 {
+		c.ShutdownFunctions = append(c.ShutdownFunctions, func(*otelconfig.Config) error {
+			stopAll()
+			return nil
+		})
+	}
+	return nil
+}
+
+// configProblems returns the problems with the final config c.
+func configProblems(c *otelconfig.Config) []configProblem {
+	var problems []configProblem
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, configProblem{format: format, args: args})
+	}
+
+	apikey := c.Headers[honeycombApiKeyHeader]
+	dataset := c.Headers[honeycombDatasetHeader]
+	tracesApikey := c.TracesHeaders[honeycombApiKeyHeader]
+	metricsApikey := c.MetricsHeaders[honeycombApiKeyHeader]
+	if len(apikey) == 0 {
+		if tracesApikey == "" && metricsApikey == "" {
+			problem(noApiKeyDetectedMessage)
+		}
+	} else if isClassicKey(apikey) {
+		if dataset == "" {
+			problem("%s\n%s", classicKeyMissingDatasetMessage, apikey)
+		}
+	} else {
+		if dataset != "" {
+			problem(dontSetADatasetMessageMessage)
+		}
+	}
+
+	// the generic key is only used by signals without their own key
+	genericKeyUsed := (c.TracesEnabled && tracesApikey == "") || (c.MetricsEnabled && metricsApikey == "")
+	if apikey != "" && !genericKeyUsed && (c.TracesEnabled || c.MetricsEnabled) &&
+		((tracesApikey != "" && tracesApikey != apikey) || (metricsApikey != "" && metricsApikey != apikey)) {
+		problem(conflictingApiKeysMessage)
+	}
+
+	for _, endpoint := range []struct {
+		name  string
+		value string
+	}{
+		{"exporter endpoint", c.ExporterEndpoint},
+		{"traces exporter endpoint", c.TracesExporterEndpoint},
+		{"metrics exporter endpoint", c.MetricsExporterEndpoint},
+	} {
+		if endpoint.value != "" && !isValidEndpoint(endpoint.value) {
+			problem(invalidEndpointMessage, endpoint.name, endpoint.value)
+		}
+	}
+	return problems
+}
+
+// reportConfigProblems logs the problems with c, or returns them in strict mode.
+func reportConfigProblems(c *otelconfig.Config, v *configState) error {
+	problems := append(v.problems, configProblems(c)...)
+	if v.keyValidator != nil {
+		problems = append(problems, v.keyValidator.problems(c)...)
+	}
+	var errs []error
+	for _, p := range problems {
+		if err := v.reportProblem(c, p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reportProblem logs p, or returns it in strict mode, such as for problems only found by a setup
+// step once the config has been validated.
+func (v *configState) reportProblem(c *otelconfig.Config, p configProblem) error {
+	if v.strict {
+		return p
+	}
+	if p.warn {
+		warnf(c, p.format, p.args...)
+	} else if c.Logger != nil {
+		c.Logger.Debugf(p.format, p.args...)
+	}
+	return nil
+}
+
+// warnLogger is implemented by loggers that can log warnings, which otelconfig's Logger can't.
+type warnLogger interface {
+	Warnf(format string, v ...interface{})
+}
+
+// warnf logs a message that should be seen even when debug logging is off, using the configured
+// logger if it can log warnings, or else the standard logger that otelconfig's default logger
+// also writes to.
+func warnf(c *otelconfig.Config, format string, args ...interface{}) {
+	if logger, ok := c.Logger.(warnLogger); ok {
+		logger.Warnf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,145 @@
+// Copyright Honeycomb Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package honeycomb
+
+import (
+	"testing"
+
+	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictValidationReturnsProblems(t *testing.T) {
+	classicKey := "12345678901234567890123456789012"
+	modernKey := "123456789012345678901"
+
+	testCases := []struct {
+		desc          string
+		configure     func(c *otelconfig.Config)
+		expectedError string
+	}{
+		{
+			desc:      "modern API key",
+			configure: WithApiKey(modernKey),
+		},
+		{
+			desc:          "missing API key",
+			configure:     func(c *otelconfig.Config) {},
+			expectedError: noApiKeyDetectedMessage,
+		},
+		{
+			desc:          "classic API key without a dataset",
+			configure:     WithApiKey(classicKey),
+			expectedError: classicKeyMissingDatasetMessage,
+		},
+		{
+			desc: "modern API key with a dataset",
+			configure: func(c *otelconfig.Config) {
+				WithApiKey(modernKey)(c)
+				WithDataset("spans")(c)
+			},
+			expectedError: dontSetADatasetMessageMessage,
+		},
+		{
+			desc: "malformed endpoint",
+			configure: func(c *otelconfig.Config) {
+				WithApiKey(modernKey)(c)
+				c.TracesExporterEndpoint = "https://api honeycomb.io"
+			},
+			expectedError: `The traces exporter endpoint "https://api honeycomb.io" is not a valid URL or host.`,
+		},
+		{
+			desc: "per-signal API key overriding an unused API key",
+			configure: func(c *otelconfig.Config) {
+				WithApiKey(modernKey)(c)
+				WithTracesApiKey("another-key")(c)
+				c.TracesEnabled = true
+			},
+			expectedError: conflictingApiKeysMessage,
+		},
+		{
+			desc: "per-signal API key alongside an API key used by metrics",
+			configure: func(c *otelconfig.Config) {
+				WithApiKey(modernKey)(c)
+				WithTracesApiKey("another-key")(c)
+				c.TracesEnabled = true
+				c.MetricsEnabled = true
+			},
+		},
+		{
+			desc: "per-signal API keys only",
+			configure: func(c *otelconfig.Config) {
+				WithTracesApiKey(modernKey)(c)
+				WithMetricsApiKey(modernKey)(c)
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			config := freshConfig()
+			config.Logger = &captureLogger{}
+			WithStrictValidation()(config)
+			tC.configure(config)
+
+			err := validateConfig(config)
+			if tC.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tC.expectedError)
+			}
+		})
+	}
+}
+
+func TestProblemsAreLoggedWithoutStrictValidation(t *testing.T) {
+	config := freshConfig()
+	logger := &captureLogger{}
+	config.Logger = logger
+	WithApiKey("123456789012345678901")(config)
+	config.ExporterEndpoint = "not a host"
+
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, invalidEndpointMessage, logger.Format)
+	assert.Equal(t, []interface{}{"exporter endpoint", "not a host"}, logger.Values)
+}
+
+func TestStrictConfigEnvironmentVariableRejectsInvalidSettings(t *testing.T) {
+	useValidateConfig(t)
+	t.Setenv("HONEYCOMB_STRICT_CONFIG", "true")
+	t.Setenv("HONEYCOMB_API_KEY", "123456789012345678901")
+	t.Setenv("SAMPLE_RATE", "ten")
+
+	shutdown, err := otelconfig.ConfigureOpenTelemetry()
+	if shutdown != nil {
+		defer shutdown()
+	}
+	assert.ErrorContains(t, err, `SAMPLE_RATE is "ten", but should be a whole number`)
+}
+
+func TestValidationForgetsConfigState(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		config := freshConfig()
+		config.Logger = &captureLogger{}
+		if strict {
+			WithStrictValidation()(config)
+		}
+
+		err := validateConfig(config)
+		assert.Equal(t, strict, err != nil)
+		_, ok := configStates.Load(config)
+		assert.False(t, ok)
+	}
+}